@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"net"
+	"net/http"
+
+	"go-micro.dev/v4/errors"
+)
+
+// AccessMiddleware answers requests with a 403 unless the client ip is within one of the
+// allowed networks and none of the denied ones. An empty allow list allows any client.
+// The client ip is taken from X-Forwarded-For only for requests from trusted proxies.
+func AccessMiddleware(allow, deny, trusted []net.IPNet) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if !allowed(ClientIP(request, trusted), allow, deny) {
+				writeError(writer, errors.Forbidden(packageID, "access denied"))
+				return
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// allowed reports whether the ip passes the allow and deny lists, deny taking precedence
+func allowed(ip string, allow, deny []net.IPNet) bool {
+	if isTrusted(ip, deny) {
+		return false
+	}
+	return len(allow) == 0 || isTrusted(ip, allow)
+}
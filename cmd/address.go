@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const unixScheme = "unix://"
+
+// splitAddress returns the network and listen address of a server address,
+// either host:port for tcp or unix:///path/to.sock for a unix socket
+func splitAddress(address string) (network, addr string) {
+	if strings.HasPrefix(address, unixScheme) {
+		return "unix", strings.TrimPrefix(address, unixScheme)
+	}
+	return "tcp", address
+}
+
+// validateAddress checks the address is of the form host:port, e.g. ":8080" or "127.0.0.1:8080",
+// or a unix socket such as unix:///var/run/gateway.sock
+func validateAddress(address string) error {
+	if network, path := splitAddress(address); network == "unix" {
+		if len(path) == 0 {
+			return fmt.Errorf("invalid server address %q, expected a socket path such as unix:///var/run/gateway.sock", address)
+		}
+		return nil
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid server address %q, expected host:port such as :8080: %v", address, err)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		return fmt.Errorf("invalid server address %q, port %q is not a number between 0 and 65535", address, port)
+	}
+	return nil
+}
+
+// removeStaleSocket removes a socket file left behind by a previous process,
+// refusing to touch it while something is still listening on it
+func removeStaleSocket(path string) error {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%v exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%v is in use by another process", path)
+	}
+	return os.Remove(path)
+}
@@ -4,6 +4,17 @@ import (
 	"github.com/go-micro/api/cmd"
 )
 
+// set at build time, e.g.
+// go build -ldflags "-X main.version=v1.0.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	version   string
+	commit    string
+	buildDate string
+)
+
 func main() {
-	cmd.Run()
+	cmd.Run(
+		cmd.WithVersion(version),
+		cmd.WithBuildInfo(commit, buildDate),
+	)
 }
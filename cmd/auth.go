@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go-micro.dev/v4/errors"
+)
+
+// AuthMiddleware requires an "Authorization: Bearer <token>" header matching token.
+// Preflight requests are exempt so cors keeps working.
+func AuthMiddleware(token string) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.Method == http.MethodOptions {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			if !validBearer(request, token) {
+				writer.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(writer, errors.Unauthorized(packageID, "invalid or missing bearer token"))
+				return
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+func validBearer(request *http.Request, token string) bool {
+	bearer, ok := bearerToken(request)
+	return ok && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
+
+// bearerToken returns the token of an "Authorization: Bearer <token>" header
+func bearerToken(request *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	auth := request.Header.Get("Authorization")
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return auth[len(prefix):], true
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "go-micro.dev/v4/logger"
+)
+
+// replaces redacted header and field values
+const redacted = "[REDACTED]"
+
+// DefaultRedactFields are the headers and body fields redacted by the body log
+var DefaultRedactFields = []string{"Authorization", "Cookie", "Set-Cookie", "password", "token", "secret"}
+
+// BodyLogMiddleware logs the headers and the first max bytes of the request and response
+// bodies for debugging. Headers and json or form fields named in redact are masked, matched
+// case insensitively. The request body is handed to the handler unchanged.
+func BodyLogMiddleware(max int, redact []string) func(http.Handler) http.Handler {
+	redactBody := redactPattern(redact)
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			// read the start of the body up front, so it's logged even when the
+			// handler fails before reading it, and put it back for the handler
+			reqBody := &cappedBuffer{max: max}
+			if request.Body != nil && request.Body != http.NoBody {
+				body := request.Body
+				prefix, _ := io.ReadAll(io.LimitReader(body, int64(max)+1))
+				reqBody.Write(prefix)
+				if !rewindBody(request) {
+					request.Body = struct {
+						io.Reader
+						io.Closer
+					}{io.MultiReader(bytes.NewReader(prefix), body), body}
+				}
+			}
+			bw := &bodyLogWriter{responseWriter: newResponseWriter(writer), body: &cappedBuffer{max: max}}
+			handler.ServeHTTP(bw, request)
+
+			logger := requestLogger(request.Context())
+			if id, ok := RequestIDFromContext(request.Context()); ok {
+				logger = logger.Fields(map[string]interface{}{"request_id": id})
+			}
+			logger.Logf(log.InfoLevel, "method=%s path=%s status=%d request_headers=%q request_body=%q response_headers=%q response_body=%q",
+				request.Method, request.URL.Path, bw.status,
+				formatHeaders(request.Header, redact), reqBody.redact(redactBody),
+				formatHeaders(bw.Header(), redact), bw.body.redact(redactBody))
+		})
+	}
+}
+
+// bodyLogWriter copies the start of the response body
+type bodyLogWriter struct {
+	*responseWriter
+	body *cappedBuffer
+}
+
+func (w *bodyLogWriter) Write(b []byte) (int, error) {
+	n, err := w.responseWriter.Write(b)
+	w.body.Write(b[:n])
+	return n, err
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the rest
+type cappedBuffer struct {
+	bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+func (b *cappedBuffer) redact(pattern *regexp.Regexp) string {
+	s := b.String()
+	if pattern != nil {
+		s = pattern.ReplaceAllString(s, "${1}"+redacted)
+	}
+	if b.truncated {
+		s += "...(truncated)"
+	}
+	return s
+}
+
+// redactPattern matches the values of the named json or form fields,
+// including values cut off by the size cap
+func redactPattern(fields []string) *regexp.Regexp {
+	if len(fields) == 0 {
+		return nil
+	}
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = regexp.QuoteMeta(f)
+	}
+	name := strings.Join(names, "|")
+	return regexp.MustCompile(fmt.Sprintf(`(?i)("(?:%[1]s)"\s*:\s*|(?:^|&)(?:%[1]s)=)(?:"(?:[^"\\]|\\.)*"?|[^,}&\s]*)`, name))
+}
+
+// formatHeaders formats the headers sorted by name with the redacted ones masked
+func formatHeaders(header http.Header, redact []string) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		for _, r := range redact {
+			if strings.EqualFold(r, name) {
+				value = redacted
+				break
+			}
+		}
+		lines = append(lines, name+": "+value)
+	}
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-micro.dev/v4/errors"
+	log "go-micro.dev/v4/logger"
+)
+
+// CircuitBreakerMiddleware stops forwarding to a service after threshold consecutive
+// failed responses, answering with a 503 for the timeout window. A single probe is then
+// let through, closing the circuit on success or opening it again on failure. Services
+// are identified by the route resolved by RouteMiddleware.
+func CircuitBreakerMiddleware(threshold int, timeout time.Duration) func(http.Handler) http.Handler {
+	breakers := newBreakers(threshold, timeout)
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			service := serviceName(request)
+			if service == "unknown" {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			ok, probe, retry := breakers.allow(service)
+			if !ok {
+				writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+				writeError(writer, errors.New(packageID, "service "+service+" is unavailable", http.StatusServiceUnavailable))
+				return
+			}
+
+			rw := newResponseWriter(writer)
+			failed := true
+			// a panicking handler counts as a failure
+			defer func() {
+				breakers.done(requestLogger(request.Context()), service, probe, failed)
+			}()
+			handler.ServeHTTP(rw, request)
+			failed = rw.status >= http.StatusInternalServerError
+		})
+	}
+}
+
+type breakers struct {
+	threshold int
+	timeout   time.Duration
+
+	mtx      sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures int
+	// when the circuit opened, zero while closed
+	opened time.Time
+	// whether the half open probe is in flight
+	probing bool
+}
+
+func newBreakers(threshold int, timeout time.Duration) *breakers {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &breakers{
+		threshold: threshold,
+		timeout:   timeout,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+// allow reports whether a request to the service may proceed and whether it is the
+// half open probe, or how long until it is retried
+func (b *breakers) allow(service string) (ok bool, probe bool, retry time.Duration) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	c, found := b.circuits[service]
+	if !found || c.opened.IsZero() {
+		return true, false, 0
+	}
+	if wait := b.timeout - time.Since(c.opened); wait > 0 {
+		return false, false, wait
+	}
+	if c.probing {
+		return false, false, b.timeout
+	}
+	c.probing = true
+	return true, true, 0
+}
+
+// done records the outcome of a request allowed through. Only the probe decides an
+// open circuit, requests let through before it opened may complete late.
+func (b *breakers) done(logger log.Logger, service string, probe, failed bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	c, ok := b.circuits[service]
+	if !ok {
+		if !failed {
+			return
+		}
+		c = &circuit{}
+		b.circuits[service] = c
+	}
+	if probe {
+		c.probing = false
+	} else if !c.opened.IsZero() {
+		return
+	}
+	if !failed {
+		if !c.opened.IsZero() {
+			logger.Logf(log.InfoLevel, "Circuit closed for service %s", service)
+		}
+		delete(b.circuits, service)
+		return
+	}
+	c.failures++
+	if probe || (c.opened.IsZero() && c.failures >= b.threshold) {
+		if c.opened.IsZero() {
+			logger.Logf(log.WarnLevel, "Circuit opened for service %s after %d failures", service, c.failures)
+		}
+		c.opened = time.Now()
+	}
+}
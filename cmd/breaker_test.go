@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	log "go-micro.dev/v4/logger"
+)
+
+func TestBreakerSingleProbe(t *testing.T) {
+	b := newBreakers(1, 10*time.Millisecond)
+
+	// two requests are let through while closed, the second completes late
+	for i := 0; i < 2; i++ {
+		if ok, probe, _ := b.allow("greeter"); !ok || probe {
+			t.Fatal("expected a closed circuit to allow requests")
+		}
+	}
+	b.done(log.DefaultLogger, "greeter", false, true)
+	if ok, _, _ := b.allow("greeter"); ok {
+		t.Fatal("expected the circuit to open after the threshold")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	ok, probe, _ := b.allow("greeter")
+	if !ok || !probe {
+		t.Fatal("expected a half open probe once the timeout passed")
+	}
+	b.done(log.DefaultLogger, "greeter", false, false)
+	if ok, _, _ := b.allow("greeter"); ok {
+		t.Fatal("expected a single probe while it is in flight")
+	}
+
+	b.done(log.DefaultLogger, "greeter", probe, false)
+	if ok, _, _ := b.allow("greeter"); !ok {
+		t.Fatal("expected a successful probe to close the circuit")
+	}
+}
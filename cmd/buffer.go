@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go-micro.dev/v4/errors"
+)
+
+// replayableBody is a request body buffered in memory, which rewindBody resets
+// so it can be read again
+type replayableBody struct {
+	*bytes.Reader
+}
+
+func (replayableBody) Close() error {
+	return nil
+}
+
+// BufferBodyMiddleware reads request bodies into memory up front so middleware and
+// retries can replay them, answering bodies larger than limit bytes with a 413.
+// A limit of 0 buffers bodies of any size.
+func BufferBodyMiddleware(limit int64) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if limit > 0 && request.ContentLength > limit {
+				writeError(writer, errors.New(packageID, fmt.Sprintf("request body exceeds %d bytes", limit), http.StatusRequestEntityTooLarge))
+				return
+			}
+			if err := bufferBody(request, limit); err != nil {
+				writeError(writer, err)
+				return
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// bufferBody replaces the request body with a replayable copy, unless it already is one
+func bufferBody(request *http.Request, limit int64) error {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+	if _, ok := request.Body.(replayableBody); ok {
+		return nil
+	}
+	var body io.Reader = request.Body
+	if limit > 0 {
+		body = io.LimitReader(body, limit+1)
+	}
+	b, err := io.ReadAll(body)
+	request.Body.Close()
+	if tooLarge, ok := err.(bodyTooLargeError); ok {
+		return errors.New(packageID, tooLarge.Error(), http.StatusRequestEntityTooLarge)
+	}
+	if err != nil {
+		return errors.BadRequest(packageID, "unable to read request body: %v", err)
+	}
+	if limit > 0 && int64(len(b)) > limit {
+		return errors.New(packageID, fmt.Sprintf("request body exceeds %d bytes", limit), http.StatusRequestEntityTooLarge)
+	}
+	// the length is known once buffered, so it's sent rather than chunked
+	request.ContentLength = int64(len(b))
+	request.TransferEncoding = nil
+	request.Body = replayableBody{bytes.NewReader(b)}
+	request.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	return nil
+}
+
+// rewindBody resets a body buffered by bufferBody to its start, reporting
+// false when the body is streamed instead
+func rewindBody(request *http.Request) bool {
+	body, ok := request.Body.(replayableBody)
+	if ok {
+		body.Seek(0, io.SeekStart)
+	}
+	return ok
+}
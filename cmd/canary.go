@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-micro.dev/v4/api/router"
+	"go-micro.dev/v4/registry"
+)
+
+// CanaryRule sends a percentage of the requests for a service to one of its versions
+type CanaryRule struct {
+	Service string
+	Version string
+	// Percentage of requests, from 0 to 100
+	Percent float64
+}
+
+// ParseCanaryRule parses a service=version:percent rule, e.g. greeter=v2:10
+func ParseCanaryRule(value string) (CanaryRule, error) {
+	service, target, ok := strings.Cut(value, "=")
+	i := strings.LastIndex(target, ":")
+	if !ok || i < 0 || len(service) == 0 || i == 0 {
+		return CanaryRule{}, fmt.Errorf("invalid canary rule %q, expected service=version:percent", value)
+	}
+	percent, err := strconv.ParseFloat(target[i+1:], 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return CanaryRule{}, fmt.Errorf("invalid canary percentage in %q, expected 0 to 100", value)
+	}
+	return CanaryRule{Service: service, Version: target[:i], Percent: percent}, nil
+}
+
+// canaryRouter narrows the versions of the routes it resolves to the canary or the stable
+// versions. Requests are assigned by hashing the key header, or the client ip, so a
+// client sticks to one version and repeated routing of a request agrees. A request
+// naming the canary version in the canary header is always sent to it, other values
+// send it to the stable versions.
+type canaryRouter struct {
+	router.Router
+	rules     []CanaryRule
+	header    string
+	keyHeader string
+	trusted   []net.IPNet
+}
+
+func newCanaryRouter(rtr router.Router, rules []CanaryRule, header, keyHeader string, trusted []net.IPNet) *canaryRouter {
+	return &canaryRouter{Router: rtr, rules: rules, header: header, keyHeader: keyHeader, trusted: trusted}
+}
+
+func (r *canaryRouter) Route(request *http.Request) (*router.Route, error) {
+	route, err := r.Router.Route(request)
+	if err != nil {
+		return route, err
+	}
+	rule, ok := r.rule(route.Service)
+	if !ok {
+		return route, nil
+	}
+	canary := r.canary(request, rule)
+	var versions []*registry.Service
+	for _, service := range route.Versions {
+		if (service.Version == rule.Version) == canary {
+			versions = append(versions, service)
+		}
+	}
+	// serve from every version rather than failing while one isn't deployed
+	if len(versions) == 0 {
+		return route, nil
+	}
+	// routes may be cached by the router, so narrow a copy
+	narrowed := *route
+	narrowed.Versions = versions
+	return &narrowed, nil
+}
+
+// rule returns the rule of the service, which may be named with or without the namespace
+func (r *canaryRouter) rule(service string) (CanaryRule, bool) {
+	for _, rule := range r.rules {
+		if service == rule.Service || strings.HasSuffix(service, "."+rule.Service) {
+			return rule, true
+		}
+	}
+	return CanaryRule{}, false
+}
+
+// canary reports whether the request is sent to the canary version
+func (r *canaryRouter) canary(request *http.Request, rule CanaryRule) bool {
+	if len(r.header) > 0 {
+		if value := request.Header.Get(r.header); len(value) > 0 {
+			return value == rule.Version
+		}
+	}
+	key := ""
+	if len(r.keyHeader) > 0 {
+		key = request.Header.Get(r.keyHeader)
+	}
+	if len(key) == 0 {
+		key = ClientIP(request, r.trusted)
+	}
+	return canaryBucket(rule.Service, key) < rule.Percent*100
+}
+
+// canaryBucket hashes the key into one of 10000 buckets, salted with the service
+// so the same clients aren't the canaries of every service
+func canaryBucket(service, key string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(service))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return float64(h.Sum32() % 10000)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseCanaryRule(t *testing.T) {
+	tests := []struct {
+		value string
+		rule  CanaryRule
+		err   string
+	}{
+		{value: "greeter=v2:10", rule: CanaryRule{Service: "greeter", Version: "v2", Percent: 10}},
+		{value: "go.micro.greeter=v2.1:0.5", rule: CanaryRule{Service: "go.micro.greeter", Version: "v2.1", Percent: 0.5}},
+		{value: "greeter=v2:0", rule: CanaryRule{Service: "greeter", Version: "v2", Percent: 0}},
+		{value: "greeter=v2:100", rule: CanaryRule{Service: "greeter", Version: "v2", Percent: 100}},
+		// the percentage follows the last colon so versions may contain one
+		{value: "greeter=build:7:25", rule: CanaryRule{Service: "greeter", Version: "build:7", Percent: 25}},
+		{value: "greeter", err: "expected service=version:percent"},
+		{value: "greeter=v2", err: "expected service=version:percent"},
+		{value: "=v2:10", err: "expected service=version:percent"},
+		{value: "greeter=:10", err: "expected service=version:percent"},
+		{value: "greeter=v2:", err: "expected 0 to 100"},
+		{value: "greeter=v2:ten", err: "expected 0 to 100"},
+		{value: "greeter=v2:-1", err: "expected 0 to 100"},
+		{value: "greeter=v2:101", err: "expected 0 to 100"},
+	}
+
+	for _, tt := range tests {
+		rule, err := ParseCanaryRule(tt.value)
+		if len(tt.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseCanaryRule(%q) error %v, expected %q", tt.value, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCanaryRule(%q): %v", tt.value, err)
+			continue
+		}
+		if rule != tt.rule {
+			t.Errorf("ParseCanaryRule(%q) = %+v, expected %+v", tt.value, rule, tt.rule)
+		}
+	}
+}
+
+func TestCanaryBucket(t *testing.T) {
+	// buckets must not change between releases or clients would switch versions
+	tests := []struct {
+		service, key string
+		bucket       float64
+	}{
+		{"greeter", "user-1", 2862},
+		{"greeter", "user-2", 5243},
+		{"greeter", "10.0.0.1", 1691},
+		// salted with the service
+		{"payments", "user-1", 9787},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 3; i++ {
+			if got := canaryBucket(tt.service, tt.key); got != tt.bucket {
+				t.Fatalf("canaryBucket(%q, %q) = %v, expected %v", tt.service, tt.key, got, tt.bucket)
+			}
+		}
+	}
+
+	// about the percentage of keys is assigned to the canary
+	var canaries int
+	for i := 0; i < 10000; i++ {
+		if canaryBucket("greeter", fmt.Sprintf("user-%d", i)) < 10*100 {
+			canaries++
+		}
+	}
+	if canaries < 900 || canaries > 1100 {
+		t.Fatalf("%d of 10000 keys assigned to a 10%% canary", canaries)
+	}
+}
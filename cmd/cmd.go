@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"github.com/urfave/cli/v2"
 	"go-micro.dev/v4/api/handler"
 	"go-micro.dev/v4/api/handler/api"
 	"go-micro.dev/v4/api/handler/event"
-	"go-micro.dev/v4/api/handler/http"
+	httpHandler "go-micro.dev/v4/api/handler/http"
 	"go-micro.dev/v4/api/handler/rpc"
 	"go-micro.dev/v4/api/handler/web"
 	"go-micro.dev/v4/api/resolver"
@@ -16,11 +20,22 @@ import (
 	"go-micro.dev/v4/api/router"
 	"go-micro.dev/v4/api/router/registry"
 	"go-micro.dev/v4/api/router/static"
-	httpServer "go-micro.dev/v4/api/server/http"
-	"log"
+	"go-micro.dev/v4/api/server"
+	log "go-micro.dev/v4/logger"
+	microRegistry "go-micro.dev/v4/registry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
 type Cmd interface {
@@ -31,11 +46,45 @@ type Cmd interface {
 	Init(opts ...Option) error
 	// Options set within this command
 	Options() Options
+	// Address the server is listening on once started,
+	// e.g. the port assigned for :0
+	Address() string
+	// Starts the server without blocking, parsing the
+	// flags first unless the cmd was already initialised
+	Start() error
+	// Gracefully stops the server
+	Stop() error
+	// Parses the flags and serves until a signal is
+	// received or the context is cancelled
+	RunContext(ctx context.Context) error
 }
 
 type cmd struct {
 	opts Options
 	app  *cli.App
+
+	// flushed on shutdown when tracing is enabled
+	tracer *sdktrace.TracerProvider
+	// logs of this gateway, leaving the default logger of the process untouched
+	logger log.Logger
+	// requests drained on shutdown
+	inflight inflight
+	// resolved configuration printed by --dry_run
+	summary summary
+	// routers of the handlers, stopped with the gateway
+	routers []router.Router
+	// further servers serving the gateway on the other addresses
+	listeners []server.Server
+	// servers started and stopped alongside the gateway, e.g. for pprof
+	servers []server.Server
+	// reloads the config file on SIGHUP, nil without one
+	reloader *reloader
+	// signalled by the drain endpoint to shut down
+	drain chan struct{}
+	// receives the error of a listener failing while serving to shut down
+	serveErrors chan error
+	// set once shutdown starts so readiness fails
+	stopping int32
 }
 
 type Option func(o *Options)
@@ -44,29 +93,563 @@ var (
 	DefaultCmd   = newCmd()
 	DefaultFlags = []cli.Flag{
 		&cli.StringFlag{
-			Name:  "server_address",
-			Value: ":8080",
-			Usage: "--server_address=[server_address]",
+			Name:    "config",
+			EnvVars: []string{"MICRO_API_CONFIG"},
+			Usage:   "--config=[config_file]",
+		},
+		&cli.BoolFlag{
+			Name:    "dry_run",
+			EnvVars: []string{"MICRO_API_DRY_RUN"},
+			Usage:   "--dry_run prints the resolved configuration and exits without serving",
+		},
+		&cli.StringFlag{
+			Name:    "log_level",
+			EnvVars: []string{"MICRO_API_LOG_LEVEL"},
+			Value:   "info",
+			Usage:   "--log_level=[debug|info|warn|error]",
+		},
+		&cli.StringFlag{
+			Name:    "log_format",
+			EnvVars: []string{"MICRO_API_LOG_FORMAT"},
+			Value:   "text",
+			Usage:   "--log_format=[text|json]",
+		},
+		&cli.StringSliceFlag{
+			Name:    "server_address",
+			EnvVars: []string{"MICRO_API_SERVER_ADDRESS"},
+			Value:   cli.NewStringSlice(":8080"),
+			Usage:   "--server_address=[address,address] serving the gateway on each address",
+		},
+		&cli.StringFlag{
+			Name:    "namespace",
+			EnvVars: []string{"MICRO_API_NAMESPACE"},
+			Value:   "go.micro",
+			Usage:   "--namespace=[namespace]",
+		},
+		&cli.StringFlag{
+			Name:    "namespace_source",
+			EnvVars: []string{"MICRO_API_NAMESPACE_SOURCE"},
+			Value:   "static",
+			Usage:   "--namespace_source=[static|header]",
+		},
+		&cli.StringFlag{
+			Name:    "namespace_header",
+			EnvVars: []string{"MICRO_API_NAMESPACE_HEADER"},
+			Value:   "X-Namespace",
+			Usage:   "--namespace_header=[header]",
 		},
 		&cli.StringFlag{
-			Name:  "namespace",
-			Value: "go.micro",
-			Usage: "--namespace=[namespace]",
+			Name:    "registry",
+			EnvVars: []string{"MICRO_API_REGISTRY"},
+			Usage:   "--registry=[mdns|memory] the registry services are discovered in, defaults to the go-micro registry",
+		},
+		&cli.StringSliceFlag{
+			Name:    "registry_address",
+			EnvVars: []string{"MICRO_API_REGISTRY_ADDRESS"},
+			Usage:   "--registry_address=[host:port,host:port]",
+		},
+		&cli.StringFlag{
+			Name:    "router",
+			EnvVars: []string{"MICRO_API_ROUTER"},
+			Value:   "registry",
+			Usage:   "--router=[router]",
+		},
+		&cli.StringFlag{
+			Name:    "routes_file",
+			EnvVars: []string{"MICRO_API_ROUTES_FILE"},
+			Usage:   "--routes_file=[routes.yaml] static route table for --router=static",
+		},
+		&cli.StringFlag{
+			Name:    "resolver",
+			EnvVars: []string{"MICRO_API_RESOLVER"},
+			Value:   "vpath",
+			Usage:   "--resolver=[resolver]",
 		},
 		&cli.StringFlag{
-			Name:  "router",
-			Value: "registry",
-			Usage: "--router=[router]",
+			Name:    "handler",
+			EnvVars: []string{"MICRO_API_HANDLER"},
+			Value:   "rpc",
+			Usage:   "--handler",
 		},
 		&cli.StringFlag{
-			Name:  "resolver",
-			Value: "vpath",
-			Usage: "--resolver=[resolver]",
+			Name:    "tls_cert",
+			EnvVars: []string{"MICRO_API_TLS_CERT"},
+			Usage:   "--tls_cert=[tls_cert_file]",
 		},
 		&cli.StringFlag{
-			Name:  "handler",
-			Value: "rpc",
-			Usage: "--handler",
+			Name:    "tls_key",
+			EnvVars: []string{"MICRO_API_TLS_KEY"},
+			Usage:   "--tls_key=[tls_key_file]",
+		},
+		&cli.StringFlag{
+			Name:    "tls_client_ca",
+			EnvVars: []string{"MICRO_API_TLS_CLIENT_CA"},
+			Usage:   "--tls_client_ca=[ca_file] requires client certificates signed by the CA",
+		},
+		&cli.StringFlag{
+			Name:    "tls_client_subject_header",
+			EnvVars: []string{"MICRO_API_TLS_CLIENT_SUBJECT_HEADER"},
+			Usage:   "--tls_client_subject_header=X-Client-Subject passes the client certificate subject to services",
+		},
+		&cli.BoolFlag{
+			Name:    "https_redirect",
+			EnvVars: []string{"MICRO_API_HTTPS_REDIRECT"},
+			Usage:   "--https_redirect redirects plain http requests to https unless X-Forwarded-Proto is https",
+		},
+		&cli.StringFlag{
+			Name:    "base_path",
+			EnvVars: []string{"MICRO_API_BASE_PATH"},
+			Usage:   "--base_path=[path]",
+		},
+		&cli.StringFlag{
+			Name:    "health_path",
+			EnvVars: []string{"MICRO_API_HEALTH_PATH"},
+			Value:   "/health",
+			Usage:   "--health_path=[path]",
+		},
+		&cli.StringFlag{
+			Name:    "readiness_path",
+			EnvVars: []string{"MICRO_API_READINESS_PATH"},
+			Value:   "/ready",
+			Usage:   "--readiness_path=[path]",
+		},
+		&cli.BoolFlag{
+			Name:    "circuit_breaker",
+			EnvVars: []string{"MICRO_API_CIRCUIT_BREAKER"},
+			Usage:   "--circuit_breaker stops forwarding to services failing repeatedly",
+		},
+		&cli.IntFlag{
+			Name:    "circuit_breaker_threshold",
+			EnvVars: []string{"MICRO_API_CIRCUIT_BREAKER_THRESHOLD"},
+			Value:   5,
+			Usage:   "--circuit_breaker_threshold=5 consecutive failures opening the circuit",
+		},
+		&cli.DurationFlag{
+			Name:    "circuit_breaker_timeout",
+			EnvVars: []string{"MICRO_API_CIRCUIT_BREAKER_TIMEOUT"},
+			Value:   30 * time.Second,
+			Usage:   "--circuit_breaker_timeout=30s before an open circuit lets a probe through",
+		},
+		&cli.IntFlag{
+			Name:    "retry_count",
+			EnvVars: []string{"MICRO_API_RETRY_COUNT"},
+			Usage:   "--retry_count=2 retries idempotent requests failing with 502, 503 or 504, 0 disables retries",
+		},
+		&cli.DurationFlag{
+			Name:    "retry_backoff",
+			EnvVars: []string{"MICRO_API_RETRY_BACKOFF"},
+			Value:   100 * time.Millisecond,
+			Usage:   "--retry_backoff=100ms delay before the first retry, doubled for each further retry",
+		},
+		&cli.StringFlag{
+			Name:    "admin_address",
+			EnvVars: []string{"MICRO_API_ADMIN_ADDRESS"},
+			Usage:   "--admin_address=127.0.0.1:9090 serves health, readiness, metrics and debug endpoints on a separate listener",
+		},
+		&cli.BoolFlag{
+			Name:    "pprof",
+			EnvVars: []string{"MICRO_API_PPROF"},
+			Usage:   "--pprof serves runtime profiles at /debug/pprof/, never expose it publicly",
+		},
+		&cli.StringFlag{
+			Name:    "pprof_address",
+			EnvVars: []string{"MICRO_API_PPROF_ADDRESS"},
+			Usage:   "--pprof_address=127.0.0.1:6060 serves the profiles on a separate listener",
+		},
+		&cli.StringSliceFlag{
+			Name:    "canary",
+			EnvVars: []string{"MICRO_API_CANARY"},
+			Usage:   "--canary=greeter=v2:10 sends 10% of the requests for a service to the version, may be repeated",
+		},
+		&cli.StringFlag{
+			Name:    "canary_header",
+			EnvVars: []string{"MICRO_API_CANARY_HEADER"},
+			Value:   "X-Canary",
+			Usage:   "--canary_header=X-Canary sends requests naming the canary version to it and others to the stable versions",
+		},
+		&cli.StringFlag{
+			Name:    "canary_key_header",
+			EnvVars: []string{"MICRO_API_CANARY_KEY_HEADER"},
+			Usage:   "--canary_key_header=X-User-Id hashed to pick the canaries instead of the client ip",
+		},
+		&cli.StringSliceFlag{
+			Name:    "rewrite",
+			EnvVars: []string{"MICRO_API_REWRITE"},
+			Usage:   "--rewrite=/v1/=/ or --rewrite='^/v([0-9]+)/(.*)$=/$2' rewrites paths, the first matching rule applies",
+		},
+		&cli.StringSliceFlag{
+			Name:    "request_header_set",
+			EnvVars: []string{"MICRO_API_REQUEST_HEADER_SET"},
+			Usage:   "--request_header_set='X-Gateway: true' sets the header on requests before routing",
+		},
+		&cli.StringSliceFlag{
+			Name:    "request_header_remove",
+			EnvVars: []string{"MICRO_API_REQUEST_HEADER_REMOVE"},
+			Usage:   "--request_header_remove=[name,name] removes the headers from requests before routing",
+		},
+		&cli.StringSliceFlag{
+			Name:    "response_header",
+			EnvVars: []string{"MICRO_API_RESPONSE_HEADER"},
+			Usage:   "--response_header='Cache-Control: no-store' adds the header to every response",
+		},
+		&cli.StringFlag{
+			Name:    "response_header_mode",
+			EnvVars: []string{"MICRO_API_RESPONSE_HEADER_MODE"},
+			Value:   "set",
+			Usage:   "--response_header_mode=[set|append] replaces or appends to headers set by the backend",
+		},
+		&cli.StringSliceFlag{
+			Name:    "strip_response_headers",
+			EnvVars: []string{"MICRO_API_STRIP_RESPONSE_HEADERS"},
+			Usage:   "--strip_response_headers=[Server,X-Powered-By] removes the headers from responses",
+		},
+		&cli.StringFlag{
+			Name:    "fallback_url",
+			EnvVars: []string{"MICRO_API_FALLBACK_URL"},
+			Usage:   "--fallback_url=[url] proxies requests no service matches to the upstream",
+		},
+		&cli.BoolFlag{
+			Name:    "debug_signals",
+			EnvVars: []string{"MICRO_API_DEBUG_SIGNALS"},
+			Usage:   "--debug_signals writes the goroutine stacks to stderr on SIGUSR1",
+		},
+		&cli.BoolFlag{
+			Name:    "debug_routes",
+			EnvVars: []string{"MICRO_API_DEBUG_ROUTES"},
+			Usage:   "--debug_routes serves the discovered services and endpoints at /_debug/routes",
+		},
+		&cli.BoolFlag{
+			Name:    "openapi",
+			EnvVars: []string{"MICRO_API_OPENAPI"},
+			Usage:   "--openapi serves the OpenAPI documents of the services merged into one at --openapi_path",
+		},
+		&cli.StringFlag{
+			Name:    "openapi_path",
+			EnvVars: []string{"MICRO_API_OPENAPI_PATH"},
+			Value:   "/openapi.json",
+			Usage:   "--openapi_path=/openapi.json serving the merged document",
+		},
+		&cli.StringFlag{
+			Name:    "openapi_spec_path",
+			EnvVars: []string{"MICRO_API_OPENAPI_SPEC_PATH"},
+			Value:   "/openapi.json",
+			Usage:   "--openapi_spec_path=/openapi.json fetched from each service node",
+		},
+		&cli.DurationFlag{
+			Name:    "openapi_refresh",
+			EnvVars: []string{"MICRO_API_OPENAPI_REFRESH"},
+			Value:   time.Minute,
+			Usage:   "--openapi_refresh=1m caching the merged document",
+		},
+		&cli.BoolFlag{
+			Name:    "drain_signal",
+			EnvVars: []string{"MICRO_API_DRAIN_SIGNAL"},
+			Usage:   "--drain_signal serves POST /_admin/drain starting a graceful shutdown, requires --auth_token",
+		},
+		&cli.BoolFlag{
+			Name:    "config_endpoint",
+			EnvVars: []string{"MICRO_API_CONFIG_ENDPOINT"},
+			Usage:   "--config_endpoint serves the effective configuration with secrets redacted at /_admin/config, requires --auth_token",
+		},
+		&cli.BoolFlag{
+			Name:    "maintenance",
+			EnvVars: []string{"MICRO_API_MAINTENANCE"},
+			Usage:   "--maintenance answers proxied requests with a 503 while health reports degraded",
+		},
+		&cli.StringFlag{
+			Name:    "maintenance_message",
+			EnvVars: []string{"MICRO_API_MAINTENANCE_MESSAGE"},
+			Value:   "down for maintenance",
+			Usage:   "--maintenance_message=[message] returned in maintenance mode",
+		},
+		&cli.BoolFlag{
+			Name:    "maintenance_endpoint",
+			EnvVars: []string{"MICRO_API_MAINTENANCE_ENDPOINT"},
+			Usage:   "--maintenance_endpoint serves /_admin/maintenance, POST enables and DELETE disables maintenance mode, requires --auth_token",
+		},
+		&cli.BoolFlag{
+			Name:    "normalize_errors",
+			EnvVars: []string{"MICRO_API_NORMALIZE_ERRORS"},
+			Usage:   "--normalize_errors renders gateway errors as {\"error\":{\"code\":...,\"message\":...}}, service errors pass through",
+		},
+		&cli.BoolFlag{
+			Name:    "debug_body_log",
+			EnvVars: []string{"MICRO_API_DEBUG_BODY_LOG"},
+			Usage:   "--debug_body_log logs request and response headers and bodies, which may contain personal data",
+		},
+		&cli.IntFlag{
+			Name:    "debug_body_max",
+			EnvVars: []string{"MICRO_API_DEBUG_BODY_MAX"},
+			Value:   4096,
+			Usage:   "--debug_body_max=4096 bytes of each body logged by --debug_body_log",
+		},
+		&cli.StringSliceFlag{
+			Name:    "debug_body_redact",
+			EnvVars: []string{"MICRO_API_DEBUG_BODY_REDACT"},
+			Value:   cli.NewStringSlice(DefaultRedactFields...),
+			Usage:   "--debug_body_redact=[name,name] headers and json or form fields masked by --debug_body_log",
+		},
+		&cli.DurationFlag{
+			Name:    "slow_request_threshold",
+			EnvVars: []string{"MICRO_API_SLOW_REQUEST_THRESHOLD"},
+			Usage:   "--slow_request_threshold=1s logs a warning for requests taking longer, 0 disables it",
+		},
+		&cli.BoolFlag{
+			Name:    "access_log",
+			EnvVars: []string{"MICRO_API_ACCESS_LOG"},
+			Usage:   "--access_log",
+		},
+		&cli.BoolFlag{
+			Name:    "request_id",
+			EnvVars: []string{"MICRO_API_REQUEST_ID"},
+			Value:   true,
+			Usage:   "--request_id=false",
+		},
+		&cli.BoolFlag{
+			Name:    "security_headers",
+			EnvVars: []string{"MICRO_API_SECURITY_HEADERS"},
+			Usage:   "--security_headers sets X-Content-Type-Options, X-Frame-Options, Referrer-Policy and over TLS Strict-Transport-Security",
+		},
+		&cli.StringFlag{
+			Name:    "security_frame_options",
+			EnvVars: []string{"MICRO_API_SECURITY_FRAME_OPTIONS"},
+			Value:   "DENY",
+			Usage:   "--security_frame_options=[DENY|SAMEORIGIN] sets X-Frame-Options, empty omits it",
+		},
+		&cli.StringFlag{
+			Name:    "security_referrer_policy",
+			EnvVars: []string{"MICRO_API_SECURITY_REFERRER_POLICY"},
+			Value:   "strict-origin-when-cross-origin",
+			Usage:   "--security_referrer_policy=[policy] sets Referrer-Policy, empty omits it",
+		},
+		&cli.DurationFlag{
+			Name:    "hsts_max_age",
+			EnvVars: []string{"MICRO_API_HSTS_MAX_AGE"},
+			Value:   365 * 24 * time.Hour,
+			Usage:   "--hsts_max_age=[duration] sets the max-age of Strict-Transport-Security, 0 omits it",
+		},
+		&cli.BoolFlag{
+			Name:    "recover",
+			EnvVars: []string{"MICRO_API_RECOVER"},
+			Value:   true,
+			Usage:   "--recover=false",
+		},
+		&cli.BoolFlag{
+			Name:    "metrics",
+			EnvVars: []string{"MICRO_API_METRICS"},
+			Usage:   "--metrics",
+		},
+		&cli.StringFlag{
+			Name:    "metrics_path",
+			EnvVars: []string{"MICRO_API_METRICS_PATH"},
+			Value:   "/metrics",
+			Usage:   "--metrics_path=[path]",
+		},
+		&cli.BoolFlag{
+			Name:    "tracing",
+			EnvVars: []string{"MICRO_API_TRACING"},
+			Usage:   "--tracing",
+		},
+		&cli.StringFlag{
+			Name:    "tracing_endpoint",
+			EnvVars: []string{"MICRO_API_TRACING_ENDPOINT"},
+			Usage:   "--tracing_endpoint=[host:port]",
+		},
+		&cli.DurationFlag{
+			Name:    "request_timeout",
+			EnvVars: []string{"MICRO_API_REQUEST_TIMEOUT"},
+			Value:   30 * time.Second,
+			Usage:   "--request_timeout=[duration]",
+		},
+		&cli.StringSliceFlag{
+			Name:    "route_timeout",
+			EnvVars: []string{"MICRO_API_ROUTE_TIMEOUT"},
+			Usage:   "--route_timeout=/reports/=2m or --route_timeout=greeter=5s overrides --request_timeout for a path prefix or service, may be repeated",
+		},
+		&cli.Int64Flag{
+			Name:    "max_body_size",
+			EnvVars: []string{"MICRO_API_MAX_BODY_SIZE"},
+			Value:   10 << 20,
+			Usage:   "--max_body_size=[bytes]",
+		},
+		&cli.BoolFlag{
+			Name:    "buffer_request_body",
+			EnvVars: []string{"MICRO_API_BUFFER_REQUEST_BODY"},
+			Usage:   "--buffer_request_body reads request bodies into memory up front, up to --max_body_size, so they can be replayed",
+		},
+		&cli.BoolFlag{
+			Name:    "compression",
+			EnvVars: []string{"MICRO_API_COMPRESSION"},
+			Usage:   "--compression",
+		},
+		&cli.IntFlag{
+			Name:    "compression_min_size",
+			EnvVars: []string{"MICRO_API_COMPRESSION_MIN_SIZE"},
+			Value:   1024,
+			Usage:   "--compression_min_size=[bytes]",
+		},
+		&cli.StringFlag{
+			Name:    "auth_token",
+			EnvVars: []string{"MICRO_API_AUTH_TOKEN"},
+			Usage:   "--auth_token=[token]",
+		},
+		&cli.StringFlag{
+			Name:    "jwt_jwks_url",
+			EnvVars: []string{"MICRO_API_JWT_JWKS_URL"},
+			Usage:   "--jwt_jwks_url=[url]",
+		},
+		&cli.Float64Flag{
+			Name:    "rate_limit",
+			EnvVars: []string{"MICRO_API_RATE_LIMIT"},
+			Usage:   "--rate_limit=[requests_per_second]",
+		},
+		&cli.IntFlag{
+			Name:    "rate_limit_burst",
+			EnvVars: []string{"MICRO_API_RATE_LIMIT_BURST"},
+			Value:   10,
+			Usage:   "--rate_limit_burst=[requests]",
+		},
+		&cli.IntFlag{
+			Name:    "max_inflight",
+			EnvVars: []string{"MICRO_API_MAX_INFLIGHT"},
+			Usage:   "--max_inflight=[requests] proxied at once, 0 is unlimited",
+		},
+		&cli.DurationFlag{
+			Name:    "max_inflight_wait",
+			EnvVars: []string{"MICRO_API_MAX_INFLIGHT_WAIT"},
+			Usage:   "--max_inflight_wait=1s queues requests over --max_inflight before answering with a 503, 0 rejects them immediately",
+		},
+		&cli.BoolFlag{
+			Name:    "grpc_web",
+			EnvVars: []string{"MICRO_API_GRPC_WEB"},
+			Usage:   "--grpc_web translates grpc-web requests from browsers into grpc calls to the services, e.g. with --resolver=grpc",
+		},
+		&cli.BoolFlag{
+			Name:    "websocket",
+			EnvVars: []string{"MICRO_API_WEBSOCKET"},
+			Usage:   "--websocket proxies websocket upgrades, exempting them from timeouts, compression and retries",
+		},
+		&cli.BoolFlag{
+			Name:    "h2c",
+			EnvVars: []string{"MICRO_API_H2C"},
+			Usage:   "--h2c",
+		},
+		&cli.BoolFlag{
+			Name:    "forwarded_headers",
+			EnvVars: []string{"MICRO_API_FORWARDED_HEADERS"},
+			Usage:   "--forwarded_headers sets X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host on requests to the services",
+		},
+		&cli.StringSliceFlag{
+			Name:    "trusted_proxies",
+			EnvVars: []string{"MICRO_API_TRUSTED_PROXIES"},
+			Usage:   "--trusted_proxies=[cidr,cidr] proxies whose X-Forwarded-For header is trusted",
+		},
+		&cli.StringSliceFlag{
+			Name:    "allow_cidr",
+			EnvVars: []string{"MICRO_API_ALLOW_CIDR"},
+			Usage:   "--allow_cidr=[cidr,cidr] clients allowed to make requests, any when empty",
+		},
+		&cli.StringSliceFlag{
+			Name:    "deny_cidr",
+			EnvVars: []string{"MICRO_API_DENY_CIDR"},
+			Usage:   "--deny_cidr=[cidr,cidr] clients refused with a 403, taking precedence over --allow_cidr",
+		},
+		&cli.DurationFlag{
+			Name:    "read_timeout",
+			EnvVars: []string{"MICRO_API_READ_TIMEOUT"},
+			Value:   30 * time.Second,
+			Usage:   "--read_timeout=30s, 0 disables the timeout",
+		},
+		&cli.DurationFlag{
+			Name:    "write_timeout",
+			EnvVars: []string{"MICRO_API_WRITE_TIMEOUT"},
+			Usage:   "--write_timeout=60s, disabled by default so streams are not cut off",
+		},
+		&cli.BoolFlag{
+			Name:    "keep_alive",
+			EnvVars: []string{"MICRO_API_KEEP_ALIVE"},
+			Value:   true,
+			Usage:   "--keep_alive=false closes connections after each response, --idle_timeout applies otherwise",
+		},
+		&cli.DurationFlag{
+			Name:    "idle_timeout",
+			EnvVars: []string{"MICRO_API_IDLE_TIMEOUT"},
+			Value:   120 * time.Second,
+			Usage:   "--idle_timeout=120s, 0 disables the timeout",
+		},
+		&cli.BoolFlag{
+			Name:    "proxy_protocol",
+			EnvVars: []string{"MICRO_API_PROXY_PROTOCOL"},
+			Usage:   "--proxy_protocol reads the client address from the PROXY protocol v1 or v2 header every connection must send",
+		},
+		&cli.IntFlag{
+			Name:    "max_connections",
+			EnvVars: []string{"MICRO_API_MAX_CONNECTIONS"},
+			Usage:   "--max_connections=1000 concurrent connections per listener, further connections wait, 0 is unlimited",
+		},
+		&cli.DurationFlag{
+			Name:    "shutdown_timeout",
+			EnvVars: []string{"MICRO_API_SHUTDOWN_TIMEOUT"},
+			Value:   15 * time.Second,
+			Usage:   "--shutdown_timeout=[duration]",
+		},
+		&cli.DurationFlag{
+			Name:    "shutdown_delay",
+			EnvVars: []string{"MICRO_API_SHUTDOWN_DELAY"},
+			Usage:   "--shutdown_delay=5s keeps serving with readiness failing before draining, e.g. until removed from load balancers",
+		},
+		&cli.StringSliceFlag{
+			Name:    "cors_allowed_origins",
+			EnvVars: []string{"MICRO_API_CORS_ALLOWED_ORIGINS"},
+			Value:   cli.NewStringSlice("*"),
+			Usage:   "--cors_allowed_origins=[origin,origin] where *.example.com allows any subdomain",
+		},
+		&cli.StringSliceFlag{
+			Name:    "cors_allowed_methods",
+			EnvVars: []string{"MICRO_API_CORS_ALLOWED_METHODS"},
+			Usage:   "--cors_allowed_methods=[method,method] replacing the default methods",
+		},
+		&cli.StringSliceFlag{
+			Name:    "cors_allowed_headers",
+			EnvVars: []string{"MICRO_API_CORS_ALLOWED_HEADERS"},
+			Usage:   "--cors_allowed_headers=[header,header] replacing the default headers",
+		},
+		&cli.IntFlag{
+			Name:    "cors_max_age",
+			EnvVars: []string{"MICRO_API_CORS_MAX_AGE"},
+			Value:   600,
+			Usage:   "--cors_max_age=600 seconds browsers may cache preflight responses, 0 omits the header",
+		},
+		&cli.BoolFlag{
+			Name:    "cors_allow_credentials",
+			EnvVars: []string{"MICRO_API_CORS_ALLOW_CREDENTIALS"},
+			Usage:   "--cors_allow_credentials lets browsers send cookies and authorization headers, requires --cors_allowed_origins other than *",
+		},
+		&cli.BoolFlag{
+			Name:    "cors_reflect_headers",
+			EnvVars: []string{"MICRO_API_CORS_REFLECT_HEADERS"},
+			Usage:   "--cors_reflect_headers answers preflights with the requested headers within --cors_allowed_headers, which may be *",
+		},
+		&cli.IntFlag{
+			Name:    "cors_preflight_status",
+			EnvVars: []string{"MICRO_API_CORS_PREFLIGHT_STATUS"},
+			Value:   http.StatusOK,
+			Usage:   "--cors_preflight_status=200 status code of preflight responses, 200 or 204",
+		},
+		&cli.BoolFlag{
+			Name:    "cors_validate_preflight",
+			EnvVars: []string{"MICRO_API_CORS_VALIDATE_PREFLIGHT"},
+			Usage:   "--cors_validate_preflight answers preflights for paths no service matches with a 404",
+		},
+		&cli.BoolFlag{
+			Name:    "enable_cors_preflight_passthrough",
+			EnvVars: []string{"MICRO_API_ENABLE_CORS_PREFLIGHT_PASSTHROUGH"},
+			Usage:   "--enable_cors_preflight_passthrough passes OPTIONS requests to the services instead of answering them",
+		},
+		&cli.BoolFlag{
+			Name:    "cors_disabled",
+			EnvVars: []string{"MICRO_API_CORS_DISABLED"},
+			Usage:   "--cors_disabled",
 		},
 	}
 	DefaultRouters = map[string]func(...router.Option) router.Router{
@@ -99,7 +682,7 @@ var (
 			return event.NewHandler(option...)
 		},
 		"http": func(option ...handler.Option) handler.Handler {
-			return http.NewHandler(option...)
+			return httpHandler.NewHandler(option...)
 		},
 		"rpc": func(option ...handler.Option) handler.Handler {
 			return rpc.NewHandler(option...)
@@ -108,13 +691,18 @@ var (
 			return web.NewHandler(option...)
 		},
 	}
+	DefaultRegistries = map[string]func(...microRegistry.Option) microRegistry.Registry{
+		"mdns":   microRegistry.NewRegistry,
+		"memory": microRegistry.NewMemoryRegistry,
+	}
 )
 
 func newCmd(opts ...Option) Cmd {
 	options := Options{
-		Routers:   DefaultRouters,
-		Resolvers: DefaultResolvers,
-		Handlers:  DefaultHandlers,
+		Routers:    DefaultRouters,
+		Resolvers:  DefaultResolvers,
+		Handlers:   DefaultHandlers,
+		Registries: DefaultRegistries,
 	}
 	for _, o := range opts {
 		o(&options)
@@ -124,16 +712,52 @@ func newCmd(opts ...Option) Cmd {
 	}
 	cmd := new(cmd)
 	cmd.opts = options
+	cmd.drain = make(chan struct{}, 1)
+	cmd.serveErrors = make(chan error, 1)
+	cmd.logger = log.DefaultLogger
 	cmd.app = cli.NewApp()
 	cmd.app.Name = cmd.opts.Name
 	cmd.app.Version = cmd.opts.Version
 	cmd.app.Usage = cmd.opts.Description
 	cmd.app.Before = cmd.Before
-	cmd.app.Flags = DefaultFlags
+	cmd.app.Flags = copyFlags(DefaultFlags)
 	cmd.app.Action = cmd.Action
+	cmd.app.Commands = []*cli.Command{
+		{
+			Name:   "version",
+			Usage:  "Print the version and build information",
+			Action: cmd.Version,
+		},
+	}
 	return cmd
 }
 
+// New returns a cmd with the options applied, independent of DefaultCmd
+// so that several gateways can be run in one process
+func New(opts ...Option) Cmd {
+	return newCmd(opts...)
+}
+
+// copyFlags copies the flags so parsing in one app doesn't leak values into another
+func copyFlags(flags []cli.Flag) []cli.Flag {
+	copies := make([]cli.Flag, 0, len(flags))
+	for _, f := range flags {
+		v := reflect.ValueOf(f)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			copies = append(copies, f)
+			continue
+		}
+		c := reflect.New(v.Elem().Type())
+		c.Elem().Set(v.Elem())
+		f = c.Interface().(cli.Flag)
+		if sf, ok := f.(*cli.StringSliceFlag); ok && sf.Value != nil {
+			sf.Value = cli.NewStringSlice(sf.Value.Value()...)
+		}
+		copies = append(copies, f)
+	}
+	return copies
+}
+
 func (c *cmd) App() *cli.App {
 	return c.app
 }
@@ -142,40 +766,156 @@ func (c *cmd) Options() Options {
 	return c.opts
 }
 
-func (c *cmd) Before(ctx *cli.Context) error {
+func (c *cmd) Address() string {
+	if c.opts.Server == nil {
+		return c.opts.Address
+	}
+	return (*c.opts.Server).Address()
+}
+
+func (c *cmd) Before(ctx *cli.Context) (err error) {
+	// subcommands don't serve so skip building the gateway
+	if ctx.NArg() > 0 && c.app.Command(ctx.Args().First()) != nil {
+		return nil
+	}
+	// stop the routers already built when a later option is invalid
+	defer func() {
+		if err != nil {
+			c.release()
+		}
+	}()
+
 	var routerOpts []router.Option
 	var resolverOpts []resolver.Option
 	var handlerOpts []handler.Option
+	var serverOpts []server.Option
 
 	var newRouter = registry.NewRouter
 	var newResolver = vpath.NewResolver
 	var newHandler = rpc.NewHandler
 
-	var address = ":8080"
-	var newServer = httpServer.NewServer
+	var addresses = []string{":8080"}
+
+	var corsConfig = DefaultCorsConfig
 
-	if arg := ctx.String("server_address"); len(arg) > 0 {
-		address = arg
+	if arg := ctx.String("config"); len(arg) > 0 {
+		config, err := LoadConfig(arg)
+		if err != nil {
+			return fmt.Errorf("unable to load config: %v", err)
+		}
+		c.reloader = newReloader(ctx, arg, config)
+		if err := config.apply(ctx); err != nil {
+			return err
+		}
 	}
 
-	if arg := ctx.String("namespace"); len(arg) > 0 {
-		resolverOpts = append(resolverOpts, resolver.WithNamespace(resolver.StaticNamespace(arg)))
+	// a copy of the default logger so the format and level don't change those of
+	// the other gateways in the process
+	base := log.DefaultLogger
+	switch arg := ctx.String("log_format"); arg {
+	case "", "text":
+	case "json":
+		base = newJSONLogger(log.WithLevel(base.Options().Level))
+	default:
+		return fmt.Errorf("invalid log format %v, expected text or json", arg)
+	}
+	logger := &syncLogger{Logger: base.Fields(nil)}
+	if arg := ctx.String("log_level"); len(arg) > 0 {
+		level, err := log.GetLevel(arg)
+		if err != nil {
+			return fmt.Errorf("invalid log level %v, expected trace, debug, info, warn, error or fatal", arg)
+		}
+		if err := logger.Init(log.WithLevel(level)); err != nil {
+			return err
+		}
+	}
+	c.logger = logger
+	serverOpts = append(serverOpts, server.Logger(logger))
+	routerOpts = append(routerOpts, router.WithLogger(logger))
+	handlerOpts = append(handlerOpts, handler.WithLogger(logger))
+	if c.reloader != nil {
+		c.reloader.logger = logger
+	}
+
+	if arg := splitList(ctx.StringSlice("server_address")); len(arg) > 0 {
+		addresses = arg
+	}
+	for _, address := range addresses {
+		if err := validateAddress(address); err != nil {
+			return err
+		}
+	}
+	c.opts.Address = addresses[0]
+
+	if cert, key := ctx.String("tls_cert"), ctx.String("tls_key"); len(cert) > 0 || len(key) > 0 {
+		if len(cert) == 0 || len(key) == 0 {
+			return errors.New("both --tls_cert and --tls_key are required to enable TLS")
+		}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return fmt.Errorf("unable to load TLS key pair: %v", err)
+		}
+		config := &tls.Config{Certificates: []tls.Certificate{pair}}
+		if arg := ctx.String("tls_client_ca"); len(arg) > 0 {
+			pool, err := loadCertPool(arg)
+			if err != nil {
+				return fmt.Errorf("unable to load TLS client CA: %v", err)
+			}
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+			config.ClientCAs = pool
+		}
+		serverOpts = append(serverOpts,
+			server.EnableTLS(true),
+			server.TLSConfig(config),
+		)
+		c.opts.TLSConfig = config
+	} else if len(ctx.String("tls_client_ca")) > 0 {
+		return errors.New("--tls_client_ca requires --tls_cert and --tls_key")
+	}
+
+	c.opts.ShutdownTimeout = ctx.Duration("shutdown_timeout")
+	c.opts.ShutdownDelay = ctx.Duration("shutdown_delay")
+
+	switch arg := ctx.String("namespace_source"); arg {
+	case "", "static":
+		if ns := ctx.String("namespace"); len(ns) > 0 {
+			resolverOpts = append(resolverOpts, resolver.WithNamespace(resolver.StaticNamespace(ns)))
+		}
+	case "header":
+		resolverOpts = append(resolverOpts, resolver.WithNamespace(HeaderNamespace(ctx.String("namespace_header"), ctx.String("namespace"))))
+	default:
+		return fmt.Errorf("namespace source %v is not supported, expected static or header", arg)
+	}
+
+	if arg := ctx.String("registry"); len(arg) > 0 {
+		newRegistry, ok := c.opts.Registries[arg]
+		if !ok {
+			return fmt.Errorf("registry %v is not found", arg)
+		}
+		var registryOpts []microRegistry.Option
+		if addrs := splitList(ctx.StringSlice("registry_address")); len(addrs) > 0 {
+			registryOpts = append(registryOpts, microRegistry.Addrs(addrs...))
+		}
+		c.opts.Registry = newRegistry(registryOpts...)
+	}
+	if c.opts.Registry != nil {
+		routerOpts = append(routerOpts, router.WithRegistry(c.opts.Registry))
 	}
 
 	if arg := ctx.String("router"); len(arg) > 0 {
 		if r, ok := c.opts.Routers[arg]; ok {
 			newRouter = r
 		} else {
-			log.Fatalf("Router %v is not found", arg)
+			return fmt.Errorf("router %v is not found", arg)
 		}
 	}
 
-	if arg := ctx.String("handler"); len(arg) > 0 {
-		resolverOpts = append(resolverOpts, resolver.WithHandler(arg))
+	handlerName := ctx.String("handler")
+	if arg := handlerName; len(arg) > 0 {
 		if h, ok := c.opts.Handlers[arg]; ok {
 			newHandler = h
 		} else {
-			log.Fatalf("Handler %v is not found", arg)
+			return fmt.Errorf("handler %v is not found", arg)
 		}
 	}
 
@@ -183,38 +923,805 @@ func (c *cmd) Before(ctx *cli.Context) error {
 		if r, ok := c.opts.Resolvers[arg]; ok {
 			newResolver = r
 		} else {
-			log.Fatalf("Resolver %v is not found", arg)
+			return fmt.Errorf("resolver %v is not found", arg)
+		}
+	}
+
+	if arg := splitList(ctx.StringSlice("cors_allowed_origins")); len(arg) > 0 {
+		corsConfig.AllowedOrigins = arg
+	}
+	if arg := splitList(ctx.StringSlice("cors_allowed_methods")); len(arg) > 0 {
+		corsConfig.AllowedMethods = arg
+	}
+	if arg := splitList(ctx.StringSlice("cors_allowed_headers")); len(arg) > 0 {
+		corsConfig.AllowedHeaders = arg
+	}
+	corsConfig.MaxAge = ctx.Int("cors_max_age")
+	corsConfig.AllowCredentials = ctx.Bool("cors_allow_credentials")
+	corsConfig.ReflectRequestHeaders = ctx.Bool("cors_reflect_headers")
+	corsConfig.PreflightPassthrough = ctx.Bool("enable_cors_preflight_passthrough")
+	switch arg := ctx.Int("cors_preflight_status"); arg {
+	case http.StatusOK, http.StatusNoContent:
+		corsConfig.PreflightStatus = arg
+	default:
+		return fmt.Errorf("invalid cors preflight status %v, expected 200 or 204", arg)
+	}
+
+	if ctx.Bool("grpc_web") {
+		// let browsers send the grpc-web headers and read the status of trailers only responses
+		corsConfig.AllowedHeaders = grpcWebAllowedHeaders(corsConfig.AllowedHeaders)
+		corsConfig.ExposedHeaders = append(append([]string{}, corsConfig.ExposedHeaders...), "Grpc-Status", "Grpc-Message")
+	}
+
+	c.opts.CorsDisabled = ctx.Bool("cors_disabled")
+	if !c.opts.CorsDisabled {
+		if err := corsConfig.validate(); err != nil {
+			return fmt.Errorf("%v, set --cors_allowed_origins", err)
+		}
+	}
+
+	if arg := ctx.Int64("max_body_size"); arg > 0 {
+		handlerOpts = append(handlerOpts, handler.WithMaxRecvSize(arg))
+	}
+
+	trustedProxies, err := parseNetworks(splitList(ctx.StringSlice("trusted_proxies")))
+	if err != nil {
+		return fmt.Errorf("invalid trusted proxies: %v", err)
+	}
+
+	var canaries []CanaryRule
+	for _, arg := range splitList(ctx.StringSlice("canary")) {
+		rule, err := ParseCanaryRule(arg)
+		if err != nil {
+			return err
+		}
+		canaries = append(canaries, rule)
+	}
+
+	// newAPI creates the router and handler serving requests for the named handler
+	newAPI := func(name string, newHandler func(...handler.Option) handler.Handler) (router.Router, http.Handler) {
+		rslvOpts := append([]resolver.Option{}, resolverOpts...)
+		if len(name) > 0 {
+			rslvOpts = append(rslvOpts, resolver.WithHandler(name))
+		}
+		rslvOpts = append(rslvOpts, c.opts.ResolverOptions[ctx.String("resolver")]...)
+		rtrOpts := append(append([]router.Option{}, routerOpts...), c.opts.RouterOptions[ctx.String("router")]...)
+		var rtr router.Router = newRouter(append(rtrOpts, router.WithResolver(newResolver(rslvOpts...)))...)
+		if len(canaries) > 0 {
+			rtr = newCanaryRouter(rtr, canaries, ctx.String("canary_header"), ctx.String("canary_key_header"), trustedProxies)
 		}
+		hdlrOpts := append(append([]handler.Option{}, handlerOpts...), c.opts.HandlerOptions[name]...)
+		hdlr := newHandler(append(hdlrOpts, handler.WithRouter(rtr))...)
+		c.routers = append(c.routers, rtr)
+		return rtr, hdlr
+	}
+
+	// register the static route table with each router
+	var routes []*router.Route
+	if arg := ctx.String("routes_file"); len(arg) > 0 {
+		if ctx.String("router") != "static" {
+			return errors.New("--routes_file requires --router=static")
+		}
+		r, err := LoadRoutes(arg)
+		if err != nil {
+			return fmt.Errorf("unable to load routes: %v", err)
+		}
+		routes = r
+	}
+	register := func(rtr router.Router) error {
+		for _, route := range routes {
+			if err := rtr.Register(route); err != nil {
+				return fmt.Errorf("unable to register route %v: %v", route.Endpoint.Name, err)
+			}
+		}
+		return nil
+	}
+
+	rtr, hdlr := newAPI(handlerName, newHandler)
+	if err := register(rtr); err != nil {
+		return err
+	}
+
+	logEvent(c.logger, "Components selected", map[string]interface{}{
+		"router":   ctx.String("router"),
+		"resolver": ctx.String("resolver"),
+		"handler":  handlerName,
+	})
+	c.summary = summary{
+		addresses: addresses,
+		router:    ctx.String("router"),
+		resolver:  ctx.String("resolver"),
+		handler:   handlerName,
+		namespace: ctx.String("namespace"),
+	}
+	if ctx.String("namespace_source") == "header" {
+		c.summary.namespace += ", or the " + ctx.String("namespace_header") + " header"
 	}
 
-	routerOpts = append(routerOpts, router.WithResolver(newResolver(resolverOpts...)))
-	handlerOpts = append(handlerOpts, handler.WithRouter(newRouter(routerOpts...)))
-	hdlr := newHandler(handlerOpts...)
-	srv := newServer(address)
-	srv.Handle("/", CorsMiddleware(hdlr))
+	maxConnections := ctx.Int("max_connections")
+	if maxConnections < 0 {
+		return fmt.Errorf("invalid max connections %v", maxConnections)
+	}
+	conns := new(connCounter)
+
+	newSrv := c.opts.ServerFactory
+	if newSrv == nil {
+		newSrv = func(address string) server.Server {
+			return newServer(address, serverConfig{
+				H2C:               ctx.Bool("h2c"),
+				ReadTimeout:       ctx.Duration("read_timeout"),
+				WriteTimeout:      ctx.Duration("write_timeout"),
+				IdleTimeout:       ctx.Duration("idle_timeout"),
+				DisableKeepAlives: !ctx.Bool("keep_alive"),
+				MaxConnections:    maxConnections,
+				Connections:       conns,
+				ProxyProtocol:     ctx.Bool("proxy_protocol"),
+				Errors:            c.serveErrors,
+			})
+		}
+	}
+	srv := newSrv(addresses[0])
+	if err := srv.Init(serverOpts...); err != nil {
+		return err
+	}
+	// further addresses serve the same handlers
+	for _, address := range addresses[1:] {
+		l := newSrv(address)
+		if err := l.Init(serverOpts...); err != nil {
+			return err
+		}
+		c.listeners = append(c.listeners, l)
+	}
+
+	// endpoints by path, as the server panics when a path is registered twice
+	served := make(map[string]string)
+
+	// handle registers the endpoint on the server and the further listeners
+	handle := func(path, name string, h http.Handler) error {
+		if prior, ok := served[path]; ok {
+			return fmt.Errorf("path %v is already served by %v", path, prior)
+		}
+		served[path] = name
+		h = loggerMiddleware(logger)(h)
+		srv.Handle(path, h)
+		for _, l := range c.listeners {
+			l.Handle(path, h)
+		}
+		c.summary.endpoints = append(c.summary.endpoints, path+" "+name)
+		return nil
+	}
+
+	// endpoints are mounted under the base path without a trailing slash
+	basePath := strings.TrimRight(ctx.String("base_path"), "/")
+	if len(basePath) > 0 && !strings.HasPrefix(basePath, "/") {
+		basePath = "/" + basePath
+	}
+
+	var admin server.Server
+	if arg := ctx.String("admin_address"); len(arg) > 0 {
+		if err := validateAddress(arg); err != nil {
+			return err
+		}
+		admin = newServer(arg, serverConfig{})
+		c.servers = append(c.servers, admin)
+	}
+
+	adminServed := make(map[string]string)
+	// manage registers a management endpoint, on the admin server when one is configured
+	manage := func(path, name string, h http.Handler) error {
+		if admin == nil {
+			if len(basePath) > 0 {
+				h = http.StripPrefix(basePath, h)
+			}
+			return handle(basePath+path, name, h)
+		}
+		if prior, ok := adminServed[path]; ok {
+			return fmt.Errorf("path %v is already served by %v", path, prior)
+		}
+		adminServed[path] = name
+		admin.Handle(path, loggerMiddleware(logger)(h))
+		c.summary.endpoints = append(c.summary.endpoints, admin.Address()+path+" "+name)
+		return nil
+	}
+
+	var routeTimeouts []RouteTimeout
+	var serviceTimeouts bool
+	for _, arg := range splitList(ctx.StringSlice("route_timeout")) {
+		rt, err := ParseRouteTimeout(arg)
+		if err != nil {
+			return err
+		}
+		routeTimeouts = append(routeTimeouts, rt)
+		serviceTimeouts = serviceTimeouts || !strings.HasPrefix(rt.Prefix, "/")
+	}
+
+	// resolve routes up front for middleware acting on the target service
+	resolveRoute := ctx.Bool("metrics") || ctx.Bool("tracing") || ctx.Bool("circuit_breaker") || ctx.Duration("slow_request_threshold") > 0 ||
+		serviceTimeouts
+
+	allowCIDR, err := parseNetworks(splitList(ctx.StringSlice("allow_cidr")))
+	if err != nil {
+		return fmt.Errorf("invalid allowed cidrs: %v", err)
+	}
+	denyCIDR, err := parseNetworks(splitList(ctx.StringSlice("deny_cidr")))
+	if err != nil {
+		return fmt.Errorf("invalid denied cidrs: %v", err)
+	}
+
+	var middleware []func(http.Handler) http.Handler
+	// use appends the named middleware to the chain
+	use := func(name string, mw ...func(http.Handler) http.Handler) {
+		middleware = append(middleware, mw...)
+		for range mw {
+			c.summary.middleware = append(c.summary.middleware, name)
+		}
+	}
+	// stream appends middleware which can't apply to websocket connections
+	stream := func(name string, mw func(http.Handler) http.Handler) {
+		if ctx.Bool("websocket") {
+			mw = bypassWebSocket(mw)
+		}
+		use(name, mw)
+	}
+
+	use("inflight", c.inflight.Middleware)
+	if ctx.Bool("request_id") {
+		use("request_id", RequestIDMiddleware)
+	}
+	if arg := ctx.StringSlice("response_header"); len(arg) > 0 {
+		header, err := parseHeaders(arg)
+		if err != nil {
+			return err
+		}
+		switch mode := ctx.String("response_header_mode"); mode {
+		case "set", "append":
+			use("response_header", ResponseHeaderMiddleware(header, mode == "set"))
+		default:
+			return fmt.Errorf("invalid response header mode %v, expected set or append", mode)
+		}
+	}
+	if arg := splitList(ctx.StringSlice("strip_response_headers")); len(arg) > 0 {
+		use("strip_response_headers", StripResponseHeaderMiddleware(arg))
+	}
+	if ctx.Bool("security_headers") {
+		use("security_headers", SecurityHeaderMiddleware(SecurityHeaders{
+			FrameOptions:   ctx.String("security_frame_options"),
+			ReferrerPolicy: ctx.String("security_referrer_policy"),
+			HSTSMaxAge:     ctx.Duration("hsts_max_age"),
+		}))
+	}
+	var metrics *Metrics
+	if ctx.Bool("metrics") {
+		metrics = NewMetrics()
+		metrics.Gauge("inflight_requests", "Number of requests being served.", func() float64 {
+			return float64(c.inflight.Count())
+		})
+		metrics.Gauge("open_connections", "Number of open client connections.", func() float64 {
+			return float64(conns.Count())
+		})
+		use("metrics", metrics.MetricsMiddleware)
+		if err := manage(ctx.String("metrics_path"), "metrics", metrics.Handler()); err != nil {
+			return err
+		}
+	}
+	if ctx.Bool("tracing") {
+		tp, err := NewTracerProvider(c.app.Name, ctx.String("tracing_endpoint"))
+		if err != nil {
+			return fmt.Errorf("unable to create tracer provider: %v", err)
+		}
+		otel.SetTracerProvider(tp)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+		c.tracer = tp
+		use("tracing", TracingMiddleware(tp))
+	}
+	if ctx.Bool("access_log") {
+		use("access_log", LoggingMiddlewareWithProxies(trustedProxies))
+	}
+	if arg := ctx.Duration("slow_request_threshold"); arg > 0 {
+		use("slow_request", SlowRequestMiddleware(arg))
+	}
+	// mounted outermost so the redirect keeps the path as requested
+	if ctx.Bool("https_redirect") {
+		c.summary.middleware = append(c.summary.middleware, "https_redirect")
+	}
+	if arg := ctx.String("tls_client_subject_header"); len(arg) > 0 {
+		if len(ctx.String("tls_client_ca")) == 0 {
+			return errors.New("--tls_client_subject_header requires --tls_client_ca")
+		}
+		use("tls_client_subject", ClientSubjectMiddleware(arg))
+	}
+	if ctx.Bool("buffer_request_body") {
+		stream("buffer_request_body", BufferBodyMiddleware(ctx.Int64("max_body_size")))
+	}
+	if ctx.Bool("debug_body_log") {
+		max := ctx.Int("debug_body_max")
+		if max <= 0 {
+			return fmt.Errorf("invalid debug body max %v", max)
+		}
+		c.logger.Logf(log.WarnLevel, "Logging request and response bodies, which may contain personal data")
+		use("debug_body_log", BodyLogMiddleware(max, splitList(ctx.StringSlice("debug_body_redact"))))
+	}
+	if len(allowCIDR) > 0 || len(denyCIDR) > 0 {
+		use("access_control", AccessMiddleware(allowCIDR, denyCIDR, trustedProxies))
+	}
+	if !c.opts.CorsDisabled {
+		cors := func(h http.Handler) http.Handler {
+			return CorsMiddlewareWithConfig(corsConfig, h)
+		}
+		if c.reloader != nil {
+			c.reloader.corsConfig = corsConfig
+			c.reloader.grpcWeb = ctx.Bool("grpc_web")
+			c.reloader.cors = newSwappable(cors)
+			cors = c.reloader.cors.Middleware
+		}
+		use("cors", cors)
+	}
+	var maint *maintenance
+	if ctx.Bool("maintenance") || ctx.Bool("maintenance_endpoint") {
+		maint = newMaintenance(ctx.Bool("maintenance"), ctx.String("maintenance_message"))
+		use("maintenance", maint.Middleware)
+	}
+	if rps, burst := ctx.Float64("rate_limit"), ctx.Int("rate_limit_burst"); c.reloader != nil {
+		// installed even when disabled so a reload may enable it
+		c.reloader.rps, c.reloader.burst, c.reloader.trusted = rps, burst, trustedProxies
+		c.reloader.rateLimit = newSwappable(rateLimit(rps, burst, trustedProxies))
+		use("rate_limit", c.reloader.rateLimit.Middleware)
+	} else if rps > 0 {
+		use("rate_limit", RateLimitMiddleware(rps, burst, trustedProxies))
+	}
+	if arg := ctx.String("auth_token"); len(arg) > 0 {
+		use("auth_token", AuthMiddleware(arg))
+	}
+	if arg := ctx.String("jwt_jwks_url"); len(arg) > 0 {
+		use("jwt", JWTMiddleware(NewJWKS(arg)))
+	}
+	if arg := ctx.Int("max_inflight"); arg > 0 {
+		limiter := newConcurrencyLimiter(int64(arg), ctx.Duration("max_inflight_wait"))
+		if metrics != nil {
+			metrics.Gauge("max_inflight_active", "Number of requests holding a --max_inflight slot.", func() float64 {
+				return float64(limiter.Active())
+			})
+			metrics.Gauge("max_inflight_waiting", "Number of requests queued for a --max_inflight slot.", func() float64 {
+				return float64(limiter.Waiting())
+			})
+		}
+		stream("max_inflight", limiter.Middleware)
+	}
+	if ctx.Bool("compression") {
+		stream("compression", CompressionMiddleware(ctx.Int("compression_min_size")))
+	}
+	if arg := ctx.Duration("request_timeout"); arg > 0 || len(routeTimeouts) > 0 {
+		stream("request_timeout", RouteTimeoutMiddleware(arg, routeTimeouts))
+	}
+	if arg := ctx.Int64("max_body_size"); arg > 0 {
+		use("max_body_size", BodyLimitMiddleware(arg))
+	}
+	// inside the limits so their 503 and 504 responses aren't taken for failing upstreams
+	if ctx.Bool("circuit_breaker") {
+		use("circuit_breaker", CircuitBreakerMiddleware(ctx.Int("circuit_breaker_threshold"), ctx.Duration("circuit_breaker_timeout")))
+	}
+	if arg := ctx.Int("retry_count"); arg > 0 {
+		stream("retry", RetryMiddleware(arg, ctx.Duration("retry_backoff")))
+	}
+	use("custom", c.opts.Middleware...)
+
+	if arg := ctx.String("health_path"); len(arg) > 0 {
+		var h http.Handler = HealthHandler()
+		if maint != nil {
+			h = maint.Health(h)
+		}
+		if err := manage(arg, "health", h); err != nil {
+			return err
+		}
+	}
+	if arg := ctx.String("readiness_path"); len(arg) > 0 {
+		if err := manage(arg, "readiness", c.readiness(ReadyHandler(rtr.Options().Registry))); err != nil {
+			return err
+		}
+	}
+	if ctx.Bool("pprof") {
+		if arg := ctx.String("pprof_address"); len(arg) > 0 {
+			if err := validateAddress(arg); err != nil {
+				return err
+			}
+			ps := newServer(arg, serverConfig{})
+			ps.Handle("/debug/pprof/", PprofHandler())
+			c.servers = append(c.servers, ps)
+			c.summary.endpoints = append(c.summary.endpoints, arg+"/debug/pprof/ pprof")
+		} else {
+			if err := manage("/debug/pprof/", "pprof", PprofHandler()); err != nil {
+				return err
+			}
+		}
+	}
+	if ctx.Bool("debug_routes") {
+		if err := manage("/_debug/routes", "debug_routes", RoutesHandler(rtr.Options().Registry)); err != nil {
+			return err
+		}
+	}
+	if ctx.Bool("openapi") {
+		title := c.app.Name
+		if len(title) == 0 {
+			title = c.opts.Description
+		}
+		resolverName := ctx.String("resolver")
+		docs := &openAPI{
+			registry:  rtr.Options().Registry,
+			client:    &http.Client{Timeout: 5 * time.Second},
+			specPath:  ctx.String("openapi_spec_path"),
+			namespace: ctx.String("namespace"),
+			basePath:  basePath,
+			prefix:    resolverName == "path" || resolverName == "vpath",
+			refresh:   ctx.Duration("openapi_refresh"),
+			info:      map[string]interface{}{"title": title, "version": orUnknown(c.opts.Version)},
+			logger:    logger,
+		}
+		if err := handle(basePath+ctx.String("openapi_path"), "openapi", docs.Handler()); err != nil {
+			return err
+		}
+	}
+	if ctx.Bool("drain_signal") {
+		token := ctx.String("auth_token")
+		if len(token) == 0 {
+			return errors.New("--drain_signal requires --auth_token")
+		}
+		if err := manage("/_admin/drain", "drain", AuthMiddleware(token)(DrainHandler(c.drain))); err != nil {
+			return err
+		}
+	}
+	if ctx.Bool("maintenance_endpoint") {
+		token := ctx.String("auth_token")
+		if len(token) == 0 {
+			return errors.New("--maintenance_endpoint requires --auth_token")
+		}
+		if err := manage("/_admin/maintenance", "maintenance", AuthMiddleware(token)(maint.Handler())); err != nil {
+			return err
+		}
+	}
+	if ctx.Bool("config_endpoint") {
+		token := ctx.String("auth_token")
+		if len(token) == 0 {
+			return errors.New("--config_endpoint requires --auth_token")
+		}
+		if err := manage("/_admin/config", "config", AuthMiddleware(token)(c.configHandler(effectiveFlags(ctx)))); err != nil {
+			return err
+		}
+	}
+
+	var fallback *url.URL
+	if arg := ctx.String("fallback_url"); len(arg) > 0 {
+		u, err := url.Parse(arg)
+		if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return fmt.Errorf("invalid fallback url %q, expected e.g. http://legacy:8080", arg)
+		}
+		fallback = u
+	}
+
+	var rewrites []RewriteRule
+	for _, arg := range ctx.StringSlice("rewrite") {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid rewrite rule %q, expected from=to", arg)
+		}
+		rule, err := NewRewriteRule(parts[0], parts[1])
+		if err != nil {
+			return err
+		}
+		rewrites = append(rewrites, rule)
+	}
+
+	setHeaders, err := parseHeaders(ctx.StringSlice("request_header_set"))
+	if err != nil {
+		return err
+	}
+	removeHeaders := splitList(ctx.StringSlice("request_header_remove"))
+
+	// mount serves the handler wrapped in the middleware on the path
+	mount := func(path, name string, rtr router.Router, h http.Handler) error {
+		if ctx.Bool("grpc_web") {
+			h = GRPCWebHandler(rtr, h)
+		}
+		if metrics != nil {
+			h = metrics.UpstreamMiddleware(h)
+		}
+		if fallback != nil {
+			h = FallbackHandler(rtr, h, fallback)
+		} else if c.opts.NotFoundHandler != nil || c.opts.MethodNotAllowedHandler != nil {
+			h = NotFoundHandler(rtr, h, c.opts.NotFoundHandler, c.opts.MethodNotAllowedHandler)
+		}
+		h = chain(h, middleware...)
+		// ahead of the middleware so retries don't append the client again
+		if ctx.Bool("forwarded_headers") {
+			h = ForwardedHeadersMiddleware(trustedProxies, name == "http" || name == "web")(h)
+		}
+		// a fallback upstream may serve any path
+		if ctx.Bool("cors_validate_preflight") && fallback == nil {
+			h = PreflightRouteMiddleware(rtr)(h)
+		}
+		if resolveRoute {
+			h = RouteMiddleware(rtr)(h)
+		}
+		// modify the request ahead of resolving the route
+		if len(setHeaders) > 0 || len(removeHeaders) > 0 {
+			h = RequestHeaderMiddleware(setHeaders, removeHeaders)(h)
+		}
+		if len(rewrites) > 0 {
+			h = RewriteMiddleware(rewrites)(h)
+		}
+		if ctx.Bool("recover") {
+			h = RecoverMiddleware(h)
+		}
+		if ctx.Bool("normalize_errors") {
+			h = NormalizeErrorsMiddleware(h)
+		}
+		if len(basePath) > 0 {
+			h = http.StripPrefix(basePath, h)
+		}
+		// ahead of the base path, rewrites and route resolution which may reject the request
+		if ctx.Bool("https_redirect") {
+			h = HTTPSRedirectMiddleware(h)
+		}
+		return handle(basePath+path, name+" handler", h)
+	}
+
+	for _, route := range c.opts.HandlerRoutes {
+		newHandler, ok := c.opts.Handlers[route.Handler]
+		if !ok {
+			return fmt.Errorf("handler %v is not found", route.Handler)
+		}
+		r, h := newAPI(route.Handler, newHandler)
+		if err := register(r); err != nil {
+			return err
+		}
+		if err := mount(route.Prefix, route.Handler, r, h); err != nil {
+			return err
+		}
+	}
+	if err := mount("/", handlerName, rtr, hdlr); err != nil {
+		return err
+	}
 	c.opts.Server = &srv
 
 	return nil
 }
 
 func (c *cmd) Action(ctx *cli.Context) error {
-	if err := (*c.opts.Server).Start(); err != nil {
+	if ctx.Bool("dry_run") {
+		c.printSummary(ctx.App.Writer)
+		c.release()
+		return nil
+	}
+
+	// a failure to bind returns before any signals are watched
+	if err := c.start(); err != nil {
 		return err
 	}
+	c.logBanner(ctx.App.Writer, ctx.String("log_format"))
 
 	// wait to finish
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	defer signal.Stop(quit)
 
-	if err := (*c.opts.Server).Stop(); err != nil {
-		return err
+	// reload the config file on hangup
+	hup := make(chan os.Signal, 1)
+	if c.reloader != nil {
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+	}
+
+	// dump the goroutine stacks to diagnose hangs
+	dump := make(chan os.Signal, 1)
+	if ctx.Bool("debug_signals") && len(stackSignals) > 0 {
+		signal.Notify(dump, stackSignals...)
+		defer signal.Stop(dump)
+	}
+
+	for {
+		select {
+		case <-dump:
+			logEvent(c.logger, "Dumping goroutine stacks", map[string]interface{}{"goroutines": runtime.NumGoroutine()})
+			dumpStacks(os.Stderr)
+			continue
+		case <-hup:
+			if err := c.reloader.reload(); err != nil {
+				c.logger.Logf(log.ErrorLevel, "Unable to reload config: %v", err)
+			}
+			continue
+		case sig := <-quit:
+			logEvent(c.logger, "Shutdown initiated", map[string]interface{}{"signal": sig.String()})
+		case <-c.drain:
+			logEvent(c.logger, "Shutdown initiated", map[string]interface{}{"reason": "drain requested"})
+		case <-ctx.Done():
+			logEvent(c.logger, "Shutdown initiated", map[string]interface{}{"reason": ctx.Err().Error()})
+		case err := <-c.serveErrors:
+			// the other listeners are stopped rather than serving on without this one
+			logEvent(c.logger, "Shutdown initiated", map[string]interface{}{"reason": err.Error()})
+			c.stop()
+			return err
+		}
+		c.delayShutdown(quit)
+		return c.stop()
+	}
+}
+
+func (c *cmd) RunContext(ctx context.Context) error {
+	return c.app.RunContext(ctx, c.args())
+}
+
+func (c *cmd) Start() error {
+	if c.opts.Server == nil {
+		// parse the flags and build the gateway without running the action
+		app := *c.app
+		app.Action = func(*cli.Context) error { return nil }
+		if err := app.Run(c.args()); err != nil {
+			return err
+		}
+		if c.opts.Server == nil {
+			return errors.New("server is not configured")
+		}
+	}
+	return c.start()
+}
+
+func (c *cmd) Stop() error {
+	if c.opts.Server == nil {
+		return nil
+	}
+	logEvent(c.logger, "Shutdown initiated", nil)
+	return c.stop()
+}
+
+// args returns the command line to parse, os.Args unless set with WithArgs
+func (c *cmd) args() []string {
+	if c.opts.Args == nil {
+		return os.Args
+	}
+	return append([]string{c.app.Name}, c.opts.Args...)
+}
+
+// start starts the configured server. When any server fails to listen, e.g. as the
+// address is in use, those already started are stopped and the gateway released.
+func (c *cmd) start() error {
+	logEvent(c.logger, "Server starting", map[string]interface{}{"address": c.opts.Address})
+	if err := (*c.opts.Server).Start(); err != nil {
+		c.release()
+		return fmt.Errorf("unable to listen on %v: %w", c.opts.Address, err)
+	}
+	for _, srv := range append(c.listeners, c.servers...) {
+		if err := srv.Start(); err != nil {
+			c.stopServers(append(c.listeners, c.servers...))
+			(*c.opts.Server).Stop()
+			c.release()
+			return fmt.Errorf("unable to listen on %v: %w", srv.Address(), err)
+		}
 	}
+	logEvent(c.logger, "Server started", map[string]interface{}{"address": (*c.opts.Server).Address()})
+	return nil
+}
+
+// delayShutdown fails readiness and keeps serving for the shutdown delay so load
+// balancers stop sending requests before the drain. Another signal cuts it short.
+func (c *cmd) delayShutdown(quit <-chan os.Signal) {
+	atomic.StoreInt32(&c.stopping, 1)
+	if c.opts.ShutdownDelay <= 0 {
+		return
+	}
+	c.logger.Logf(log.InfoLevel, "Serving for %v before draining", c.opts.ShutdownDelay)
+	timer := time.NewTimer(c.opts.ShutdownDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case sig := <-quit:
+		c.logger.Logf(log.InfoLevel, "Received %v, draining now", sig)
+	}
+}
+
+// readiness fails the readiness probe once shutdown has started
+func (c *cmd) readiness(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.LoadInt32(&c.stopping) == 1 {
+			writeStatus(writer, http.StatusServiceUnavailable, "unavailable", "shutting down")
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// stopServers stops the servers, e.g. those running alongside the gateway
+func (c *cmd) stopServers(servers []server.Server) {
+	for _, srv := range servers {
+		if err := srv.Stop(); err != nil {
+			c.logger.Logf(log.WarnLevel, "Unable to stop %v server at %v: %v", srv, srv.Address(), err)
+		}
+	}
+}
 
+// stop drains the server and flushes pending traces
+func (c *cmd) stop() error {
+	// the listeners are drained along with the server
+	err := c.shutdown()
+	c.stopServers(c.servers)
+	c.release()
+
+	if err != nil {
+		return err
+	}
+	logEvent(c.logger, "Shutdown complete", nil)
 	return nil
 }
 
+// release stops the routers watching the registry and flushes pending traces,
+// once however often it is called
+func (c *cmd) release() {
+	for _, rtr := range c.routers {
+		if err := rtr.Stop(); err != nil {
+			c.logger.Logf(log.WarnLevel, "Unable to stop router: %v", err)
+		}
+	}
+	c.routers = nil
+	if tp := c.tracer; tp != nil {
+		c.tracer = nil
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			c.logger.Logf(log.WarnLevel, "Unable to flush traces: %v", err)
+		}
+	}
+}
+
+// shutdown stops the server accepting connections and drains in-flight requests
+// within the shutdown timeout before forcing the server to stop
+func (c *cmd) shutdown() error {
+	servers := append([]server.Server{*c.opts.Server}, c.listeners...)
+
+	ctx := context.Background()
+	if c.opts.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.ShutdownTimeout)
+		defer cancel()
+	}
+
+	// drain the listeners together so they share the timeout
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv server.Server) {
+			if s, ok := srv.(interface {
+				Shutdown(context.Context) error
+			}); ok {
+				errs <- s.Shutdown(ctx)
+				return
+			}
+			errs <- srv.Stop()
+		}(srv)
+	}
+	var err error
+	for range servers {
+		if serr := <-errs; serr != nil && err == nil {
+			err = serr
+		}
+	}
+	if err == nil {
+		err = c.inflight.Wait(ctx)
+	}
+
+	if err == context.DeadlineExceeded {
+		for _, srv := range servers {
+			srv.Stop()
+		}
+		return fmt.Errorf("shutdown timed out after %v with %d requests still in flight", c.opts.ShutdownTimeout, c.inflight.Count())
+	}
+	return err
+}
+
 func (c *cmd) Init(opts ...Option) error {
+	c.apply(opts...)
+	c.app.RunAndExitOnError()
+	return nil
+}
+
+// apply sets the options and updates the cli app accordingly
+func (c *cmd) apply(opts ...Option) {
 	for _, o := range opts {
 		o(&c.opts)
 	}
@@ -226,13 +1733,42 @@ func (c *cmd) Init(opts ...Option) error {
 	}
 	c.app.HideVersion = len(c.opts.Version) == 0
 	c.app.Usage = c.opts.Description
-	c.app.RunAndExitOnError()
-	return nil
 }
 
-func Run() {
-	if err := DefaultCmd.App().Run(os.Args); err != nil {
-		log.Println(err)
+// Run runs the default command with the options applied
+func Run(opts ...Option) {
+	if err := RunContext(context.Background(), opts...); err != nil {
+		log.Log(log.ErrorLevel, err)
 		os.Exit(-1)
 	}
 }
+
+// RunContext runs the default command with the options applied until a
+// signal is received or the context is cancelled, returning any error
+func RunContext(ctx context.Context, opts ...Option) error {
+	if c, ok := DefaultCmd.(*cmd); ok {
+		c.apply(opts...)
+	}
+	return DefaultCmd.RunContext(ctx)
+}
+
+// chain wraps the handler with the middleware, the first middleware being the outermost
+func chain(h http.Handler, middleware ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// splitList flattens comma separated flag values into a single list
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); len(v) > 0 {
+				list = append(list, v)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-micro.dev/v4/api/router"
+	"go-micro.dev/v4/api/router/static"
+	log "go-micro.dev/v4/logger"
+	"go-micro.dev/v4/registry"
+)
+
+// stopRecorder records the routers built by the gateway and whether they were stopped
+type stopRecorder struct {
+	sync.Mutex
+	routers []*recordingRouter
+}
+
+type recordingRouter struct {
+	router.Router
+	stopped bool
+}
+
+func (r *recordingRouter) Stop() error {
+	r.stopped = true
+	return r.Router.Stop()
+}
+
+func (s *stopRecorder) newRouter(opts ...router.Option) router.Router {
+	s.Lock()
+	defer s.Unlock()
+	r := &recordingRouter{Router: static.NewRouter(opts...)}
+	s.routers = append(s.routers, r)
+	return r
+}
+
+func (s *stopRecorder) expectStopped(t *testing.T) {
+	t.Helper()
+	s.Lock()
+	defer s.Unlock()
+	if len(s.routers) == 0 {
+		t.Fatal("no routers were built")
+	}
+	for i, r := range s.routers {
+		if !r.stopped {
+			t.Errorf("router %d was not stopped", i)
+		}
+	}
+}
+
+func TestStartAddressInUse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	addr := l.Addr().String()
+
+	rec := new(stopRecorder)
+	c := newCmd(
+		WithRegistry(registry.NewMemoryRegistry()),
+		WithRouter("test", rec.newRouter),
+		WithArgs("--server_address="+addr, "--router=test"),
+	)
+	err = c.Start()
+	if err == nil {
+		c.Stop()
+		t.Fatalf("expected %v to be in use", addr)
+	}
+
+	if !strings.Contains(err.Error(), "unable to listen on "+addr) {
+		t.Errorf("unexpected error %v", err)
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "listen" {
+		t.Errorf("expected the bind failure to be wrapped, got %#v", errors.Unwrap(err))
+	}
+	rec.expectStopped(t)
+}
+
+func TestBeforeReleasesRouters(t *testing.T) {
+	rec := new(stopRecorder)
+	c := newCmd(
+		WithRegistry(registry.NewMemoryRegistry()),
+		WithRouter("test", rec.newRouter),
+		WithArgs("--server_address=127.0.0.1:0", "--router=test", "--max_connections=-1"),
+	)
+	err := c.Start()
+	if err == nil {
+		c.Stop()
+		t.Fatal("expected the invalid max connections to be rejected")
+	}
+	if !strings.Contains(err.Error(), "invalid max connections") {
+		t.Errorf("unexpected error %v", err)
+	}
+	rec.expectStopped(t)
+}
+
+func TestGatewayLogLevel(t *testing.T) {
+	level := log.DefaultLogger.Options().Level
+	debug := startCmd(t, "--log_level=debug")
+	errs := startCmd(t, "--log_level=error")
+
+	if got := debug.logger.Options().Level; got != log.DebugLevel {
+		t.Errorf("level %v, expected debug", got)
+	}
+	if got := errs.logger.Options().Level; got != log.ErrorLevel {
+		t.Errorf("level %v, expected error", got)
+	}
+	// the default logger of the process is left untouched
+	if got := log.DefaultLogger.Options().Level; got != level {
+		t.Errorf("default logger level changed to %v", got)
+	}
+}
+
+func TestGatewayLogFormat(t *testing.T) {
+	logger := log.DefaultLogger
+	c := startCmd(t, "--log_format=json")
+
+	if got := c.logger.String(); got != "json" {
+		t.Errorf("logger %v, expected json", got)
+	}
+	if log.DefaultLogger != logger {
+		t.Errorf("default logger replaced with %v", log.DefaultLogger)
+	}
+}
+
+func TestPathCollision(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		opts []Option
+		err  string
+	}{
+		{name: "handler route at the health path", opts: []Option{WithHandlerRoute("/health", "http")}, err: "path /health is already served by health"},
+		{name: "health at the root", args: []string{"--health_path=/"}, err: "path / is already served by health"},
+		{name: "metrics at the health path", args: []string{"--metrics", "--metrics_path=/health"}, err: "path /health is already served by metrics"},
+		{name: "readiness at the health path", args: []string{"--readiness_path=/health"}, err: "path /health is already served by"},
+		{name: "openapi at the health path", args: []string{"--openapi", "--openapi_path=/health"}, err: "path /health is already served by"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--server_address=127.0.0.1:0"}, tt.args...)
+			opts := append([]Option{WithRegistry(registry.NewMemoryRegistry()), WithArgs(args...)}, tt.opts...)
+			c := newCmd(opts...)
+			err := c.Start()
+			if err == nil {
+				c.Stop()
+				t.Fatal("expected the paths to collide")
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// content types which are already compressed
+var incompressibleTypes = []string{
+	"image/", "video/", "audio/",
+	"application/zip", "application/gzip", "application/x-gzip",
+	"application/x-bzip2", "application/x-7z-compressed", "application/x-rar-compressed",
+	"application/octet-stream", "font/woff", "font/woff2",
+	// streamed events must reach the client as they are written
+	eventStreamType, grpcWebType,
+}
+
+// CompressionMiddleware gzip or deflate compresses responses of at least minSize bytes
+// when the client accepts it and the backend has not compressed them already
+func CompressionMiddleware(minSize int) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			encoding := acceptedEncoding(request.Header.Get("Accept-Encoding"))
+			if len(encoding) == 0 || request.Method == http.MethodHead {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			writer.Header().Add("Vary", "Accept-Encoding")
+			cw := &compressWriter{ResponseWriter: writer, encoding: encoding, minSize: minSize}
+			defer cw.Close()
+			handler.ServeHTTP(cw, request)
+		})
+	}
+}
+
+// acceptedEncoding picks gzip or deflate from the Accept-Encoding header
+func acceptedEncoding(header string) string {
+	var deflate bool
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if len(fields) > 1 && strings.TrimSpace(fields[1]) == "q=0" {
+			continue
+		}
+		switch name {
+		case "gzip", "*":
+			return "gzip"
+		case "deflate":
+			deflate = true
+		}
+	}
+	if deflate {
+		return "deflate"
+	}
+	return ""
+}
+
+// compressWriter buffers the start of the response until it knows whether to compress
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     []byte
+	decided bool
+	writer  io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	if !w.decided && isEventStream(w.ResponseWriter.Header()) {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided && isEventStream(w.ResponseWriter.Header()) {
+		if err := w.decide(false); err != nil {
+			return 0, err
+		}
+	}
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.writer != nil {
+		return w.writer.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide writes the header and the buffered bytes, compressed when large enough and compressible
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	header := w.ResponseWriter.Header()
+	if large && w.compressible() {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		if w.encoding == "gzip" {
+			w.writer = gzip.NewWriter(w.ResponseWriter)
+		} else {
+			w.writer, _ = flate.NewWriter(w.ResponseWriter, flate.DefaultCompression)
+		}
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.writer != nil {
+		_, err = w.writer.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *compressWriter) compressible() bool {
+	header := w.ResponseWriter.Header()
+	if len(header.Get("Content-Encoding")) > 0 {
+		return false
+	}
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	if len(contentType) == 0 {
+		contentType = http.DetectContentType(w.buf)
+	}
+	for _, t := range incompressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Flush sends what was written so far, a response flushed before reaching
+// the minimum size is streamed without compression
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		if err := w.decide(false); err != nil {
+			return
+		}
+	}
+	if f, ok := w.writer.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return
+		}
+	}
+	flush(w.ResponseWriter)
+}
+
+// Hijack hands the connection over when nothing was written yet
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.decided || len(w.buf) > 0 {
+		return nil, nil, errHijackUnsupported
+	}
+	conn, rw, err := hijack(w.ResponseWriter)
+	if err == nil {
+		w.decided = true
+	}
+	return conn, rw, err
+}
+
+func (w *compressWriter) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close flushes a small buffered response uncompressed or finishes the compressed stream
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		return w.decide(false)
+	}
+	if w.writer != nil {
+		return w.writer.Close()
+	}
+	return nil
+}
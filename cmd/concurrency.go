@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go-micro.dev/v4/errors"
+	"golang.org/x/sync/semaphore"
+)
+
+// concurrencyLimiter bounds the number of requests being proxied at once
+type concurrencyLimiter struct {
+	sem  *semaphore.Weighted
+	wait time.Duration
+
+	active  int64
+	waiting int64
+}
+
+// newConcurrencyLimiter allows max requests in flight, queueing others for up to wait
+// before answering with a 503. A wait of 0 rejects them immediately.
+func newConcurrencyLimiter(max int64, wait time.Duration) *concurrencyLimiter {
+	return &concurrencyLimiter{sem: semaphore.NewWeighted(max), wait: wait}
+}
+
+func (l *concurrencyLimiter) Middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !l.acquire(request.Context()) {
+			writeError(writer, errors.New(packageID, "too many requests in flight", http.StatusServiceUnavailable))
+			return
+		}
+		atomic.AddInt64(&l.active, 1)
+		defer func() {
+			atomic.AddInt64(&l.active, -1)
+			l.sem.Release(1)
+		}()
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+func (l *concurrencyLimiter) acquire(ctx context.Context) bool {
+	if l.sem.TryAcquire(1) {
+		return true
+	}
+	if l.wait <= 0 {
+		return false
+	}
+	atomic.AddInt64(&l.waiting, 1)
+	defer atomic.AddInt64(&l.waiting, -1)
+	ctx, cancel := context.WithTimeout(ctx, l.wait)
+	defer cancel()
+	return l.sem.Acquire(ctx, 1) == nil
+}
+
+// Active returns the number of requests holding a slot
+func (l *concurrencyLimiter) Active() int64 {
+	return atomic.LoadInt64(&l.active)
+}
+
+// Waiting returns the number of requests queued for a slot
+func (l *concurrencyLimiter) Waiting() int64 {
+	return atomic.LoadInt64(&l.waiting)
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the layout of the --config file. Each key is named after the flag it
+// sets and unset keys leave the flag untouched. Durations are given as strings, e.g. "15s".
+type Config struct {
+	DryRun                         *bool    `json:"dry_run,omitempty" yaml:"dry_run,omitempty"`
+	LogLevel                       *string  `json:"log_level,omitempty" yaml:"log_level,omitempty"`
+	LogFormat                      *string  `json:"log_format,omitempty" yaml:"log_format,omitempty"`
+	ServerAddress                  list     `json:"server_address,omitempty" yaml:"server_address,omitempty"`
+	Namespace                      *string  `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	NamespaceSource                *string  `json:"namespace_source,omitempty" yaml:"namespace_source,omitempty"`
+	NamespaceHeader                *string  `json:"namespace_header,omitempty" yaml:"namespace_header,omitempty"`
+	Registry                       *string  `json:"registry,omitempty" yaml:"registry,omitempty"`
+	RegistryAddress                []string `json:"registry_address,omitempty" yaml:"registry_address,omitempty"`
+	Router                         *string  `json:"router,omitempty" yaml:"router,omitempty"`
+	RoutesFile                     *string  `json:"routes_file,omitempty" yaml:"routes_file,omitempty"`
+	Resolver                       *string  `json:"resolver,omitempty" yaml:"resolver,omitempty"`
+	Handler                        *string  `json:"handler,omitempty" yaml:"handler,omitempty"`
+	TLSCert                        *string  `json:"tls_cert,omitempty" yaml:"tls_cert,omitempty"`
+	TLSKey                         *string  `json:"tls_key,omitempty" yaml:"tls_key,omitempty"`
+	TLSClientCA                    *string  `json:"tls_client_ca,omitempty" yaml:"tls_client_ca,omitempty"`
+	TLSClientSubjectHeader         *string  `json:"tls_client_subject_header,omitempty" yaml:"tls_client_subject_header,omitempty"`
+	HTTPSRedirect                  *bool    `json:"https_redirect,omitempty" yaml:"https_redirect,omitempty"`
+	BasePath                       *string  `json:"base_path,omitempty" yaml:"base_path,omitempty"`
+	HealthPath                     *string  `json:"health_path,omitempty" yaml:"health_path,omitempty"`
+	ReadinessPath                  *string  `json:"readiness_path,omitempty" yaml:"readiness_path,omitempty"`
+	CircuitBreaker                 *bool    `json:"circuit_breaker,omitempty" yaml:"circuit_breaker,omitempty"`
+	CircuitBreakerThreshold        *int     `json:"circuit_breaker_threshold,omitempty" yaml:"circuit_breaker_threshold,omitempty"`
+	CircuitBreakerTimeout          *string  `json:"circuit_breaker_timeout,omitempty" yaml:"circuit_breaker_timeout,omitempty"`
+	RetryCount                     *int     `json:"retry_count,omitempty" yaml:"retry_count,omitempty"`
+	RetryBackoff                   *string  `json:"retry_backoff,omitempty" yaml:"retry_backoff,omitempty"`
+	AdminAddress                   *string  `json:"admin_address,omitempty" yaml:"admin_address,omitempty"`
+	Pprof                          *bool    `json:"pprof,omitempty" yaml:"pprof,omitempty"`
+	PprofAddress                   *string  `json:"pprof_address,omitempty" yaml:"pprof_address,omitempty"`
+	Canary                         []string `json:"canary,omitempty" yaml:"canary,omitempty"`
+	CanaryHeader                   *string  `json:"canary_header,omitempty" yaml:"canary_header,omitempty"`
+	CanaryKeyHeader                *string  `json:"canary_key_header,omitempty" yaml:"canary_key_header,omitempty"`
+	Rewrite                        []string `json:"rewrite,omitempty" yaml:"rewrite,omitempty"`
+	RequestHeaderSet               []string `json:"request_header_set,omitempty" yaml:"request_header_set,omitempty"`
+	RequestHeaderRemove            []string `json:"request_header_remove,omitempty" yaml:"request_header_remove,omitempty"`
+	ResponseHeader                 []string `json:"response_header,omitempty" yaml:"response_header,omitempty"`
+	ResponseHeaderMode             *string  `json:"response_header_mode,omitempty" yaml:"response_header_mode,omitempty"`
+	StripResponseHeaders           []string `json:"strip_response_headers,omitempty" yaml:"strip_response_headers,omitempty"`
+	FallbackURL                    *string  `json:"fallback_url,omitempty" yaml:"fallback_url,omitempty"`
+	DebugSignals                   *bool    `json:"debug_signals,omitempty" yaml:"debug_signals,omitempty"`
+	DebugRoutes                    *bool    `json:"debug_routes,omitempty" yaml:"debug_routes,omitempty"`
+	OpenAPI                        *bool    `json:"openapi,omitempty" yaml:"openapi,omitempty"`
+	OpenAPIPath                    *string  `json:"openapi_path,omitempty" yaml:"openapi_path,omitempty"`
+	OpenAPISpecPath                *string  `json:"openapi_spec_path,omitempty" yaml:"openapi_spec_path,omitempty"`
+	OpenAPIRefresh                 *string  `json:"openapi_refresh,omitempty" yaml:"openapi_refresh,omitempty"`
+	DrainSignal                    *bool    `json:"drain_signal,omitempty" yaml:"drain_signal,omitempty"`
+	ConfigEndpoint                 *bool    `json:"config_endpoint,omitempty" yaml:"config_endpoint,omitempty"`
+	Maintenance                    *bool    `json:"maintenance,omitempty" yaml:"maintenance,omitempty"`
+	MaintenanceMessage             *string  `json:"maintenance_message,omitempty" yaml:"maintenance_message,omitempty"`
+	MaintenanceEndpoint            *bool    `json:"maintenance_endpoint,omitempty" yaml:"maintenance_endpoint,omitempty"`
+	NormalizeErrors                *bool    `json:"normalize_errors,omitempty" yaml:"normalize_errors,omitempty"`
+	DebugBodyLog                   *bool    `json:"debug_body_log,omitempty" yaml:"debug_body_log,omitempty"`
+	DebugBodyMax                   *int     `json:"debug_body_max,omitempty" yaml:"debug_body_max,omitempty"`
+	DebugBodyRedact                []string `json:"debug_body_redact,omitempty" yaml:"debug_body_redact,omitempty"`
+	SlowRequestThreshold           *string  `json:"slow_request_threshold,omitempty" yaml:"slow_request_threshold,omitempty"`
+	AccessLog                      *bool    `json:"access_log,omitempty" yaml:"access_log,omitempty"`
+	RequestID                      *bool    `json:"request_id,omitempty" yaml:"request_id,omitempty"`
+	SecurityHeaders                *bool    `json:"security_headers,omitempty" yaml:"security_headers,omitempty"`
+	SecurityFrameOptions           *string  `json:"security_frame_options,omitempty" yaml:"security_frame_options,omitempty"`
+	SecurityReferrerPolicy         *string  `json:"security_referrer_policy,omitempty" yaml:"security_referrer_policy,omitempty"`
+	HSTSMaxAge                     *string  `json:"hsts_max_age,omitempty" yaml:"hsts_max_age,omitempty"`
+	Recover                        *bool    `json:"recover,omitempty" yaml:"recover,omitempty"`
+	Metrics                        *bool    `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+	MetricsPath                    *string  `json:"metrics_path,omitempty" yaml:"metrics_path,omitempty"`
+	Tracing                        *bool    `json:"tracing,omitempty" yaml:"tracing,omitempty"`
+	TracingEndpoint                *string  `json:"tracing_endpoint,omitempty" yaml:"tracing_endpoint,omitempty"`
+	RequestTimeout                 *string  `json:"request_timeout,omitempty" yaml:"request_timeout,omitempty"`
+	RouteTimeout                   []string `json:"route_timeout,omitempty" yaml:"route_timeout,omitempty"`
+	MaxBodySize                    *int64   `json:"max_body_size,omitempty" yaml:"max_body_size,omitempty"`
+	BufferRequestBody              *bool    `json:"buffer_request_body,omitempty" yaml:"buffer_request_body,omitempty"`
+	Compression                    *bool    `json:"compression,omitempty" yaml:"compression,omitempty"`
+	CompressionMinSize             *int     `json:"compression_min_size,omitempty" yaml:"compression_min_size,omitempty"`
+	AuthToken                      *string  `json:"auth_token,omitempty" yaml:"auth_token,omitempty"`
+	JWTJWKSURL                     *string  `json:"jwt_jwks_url,omitempty" yaml:"jwt_jwks_url,omitempty"`
+	RateLimit                      *float64 `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"`
+	RateLimitBurst                 *int     `json:"rate_limit_burst,omitempty" yaml:"rate_limit_burst,omitempty"`
+	MaxInflight                    *int     `json:"max_inflight,omitempty" yaml:"max_inflight,omitempty"`
+	MaxInflightWait                *string  `json:"max_inflight_wait,omitempty" yaml:"max_inflight_wait,omitempty"`
+	GRPCWeb                        *bool    `json:"grpc_web,omitempty" yaml:"grpc_web,omitempty"`
+	WebSocket                      *bool    `json:"websocket,omitempty" yaml:"websocket,omitempty"`
+	H2C                            *bool    `json:"h2c,omitempty" yaml:"h2c,omitempty"`
+	ForwardedHeaders               *bool    `json:"forwarded_headers,omitempty" yaml:"forwarded_headers,omitempty"`
+	TrustedProxies                 []string `json:"trusted_proxies,omitempty" yaml:"trusted_proxies,omitempty"`
+	AllowCIDR                      []string `json:"allow_cidr,omitempty" yaml:"allow_cidr,omitempty"`
+	DenyCIDR                       []string `json:"deny_cidr,omitempty" yaml:"deny_cidr,omitempty"`
+	ReadTimeout                    *string  `json:"read_timeout,omitempty" yaml:"read_timeout,omitempty"`
+	WriteTimeout                   *string  `json:"write_timeout,omitempty" yaml:"write_timeout,omitempty"`
+	KeepAlive                      *bool    `json:"keep_alive,omitempty" yaml:"keep_alive,omitempty"`
+	IdleTimeout                    *string  `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`
+	MaxConnections                 *int     `json:"max_connections,omitempty" yaml:"max_connections,omitempty"`
+	ProxyProtocol                  *bool    `json:"proxy_protocol,omitempty" yaml:"proxy_protocol,omitempty"`
+	ShutdownDelay                  *string  `json:"shutdown_delay,omitempty" yaml:"shutdown_delay,omitempty"`
+	ShutdownTimeout                *string  `json:"shutdown_timeout,omitempty" yaml:"shutdown_timeout,omitempty"`
+	CorsAllowedOrigins             []string `json:"cors_allowed_origins,omitempty" yaml:"cors_allowed_origins,omitempty"`
+	CorsAllowedMethods             []string `json:"cors_allowed_methods,omitempty" yaml:"cors_allowed_methods,omitempty"`
+	CorsAllowedHeaders             []string `json:"cors_allowed_headers,omitempty" yaml:"cors_allowed_headers,omitempty"`
+	CorsMaxAge                     *int     `json:"cors_max_age,omitempty" yaml:"cors_max_age,omitempty"`
+	CorsAllowCredentials           *bool    `json:"cors_allow_credentials,omitempty" yaml:"cors_allow_credentials,omitempty"`
+	CorsReflectHeaders             *bool    `json:"cors_reflect_headers,omitempty" yaml:"cors_reflect_headers,omitempty"`
+	CorsPreflightStatus            *int     `json:"cors_preflight_status,omitempty" yaml:"cors_preflight_status,omitempty"`
+	CorsValidatePreflight          *bool    `json:"cors_validate_preflight,omitempty" yaml:"cors_validate_preflight,omitempty"`
+	EnableCorsPreflightPassthrough *bool    `json:"enable_cors_preflight_passthrough,omitempty" yaml:"enable_cors_preflight_passthrough,omitempty"`
+	CorsDisabled                   *bool    `json:"cors_disabled,omitempty" yaml:"cors_disabled,omitempty"`
+}
+
+// list is a list of values which may also be given as a single value,
+// e.g. server_address: ":8080" as well as a list of addresses
+type list []string
+
+func (l *list) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err == nil {
+		*l = list{value}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(l))
+}
+
+func (l *list) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = list{node.Value}
+		return nil
+	}
+	return node.Decode((*[]string)(l))
+}
+
+// LoadConfig reads a json or yaml config file, picked by the file extension
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(b, &config)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &config)
+	default:
+		return config, fmt.Errorf("unsupported config file %v, expected .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return config, fmt.Errorf("unable to parse config file %v: %v", path, err)
+	}
+	return config, nil
+}
+
+// apply sets the flags present in the config which were not set on the command line or environment
+func (c Config) apply(ctx *cli.Context) error {
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		field := v.Field(i)
+		if field.IsNil() || ctx.IsSet(name) {
+			continue
+		}
+		var values []string
+		if field.Kind() == reflect.Slice {
+			for j := 0; j < field.Len(); j++ {
+				values = append(values, fmt.Sprint(field.Index(j).Interface()))
+			}
+		} else {
+			values = append(values, fmt.Sprint(field.Elem().Interface()))
+		}
+		for _, value := range values {
+			if err := ctx.Set(name, value); err != nil {
+				return fmt.Errorf("invalid config value for %v: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		err     string
+	}{
+		{
+			name: "json",
+			file: "config.json",
+			content: `{"server_address": ":9090", "handler": "http", "shutdown_timeout": "15s",
+				"cors_allowed_origins": ["https://a.example.com", "https://b.example.com"]}`,
+		},
+		{
+			name: "yaml",
+			file: "config.yaml",
+			content: `server_address: ":9090"
+handler: http
+shutdown_timeout: 15s
+cors_allowed_origins:
+  - https://a.example.com
+  - https://b.example.com
+`,
+		},
+		{
+			name: "yml with a list of addresses",
+			file: "config.yml",
+			content: `server_address: [":9090"]
+handler: http
+shutdown_timeout: 15s
+cors_allowed_origins: [https://a.example.com, https://b.example.com]
+`,
+		},
+		{
+			name:    "toml is not supported",
+			file:    "config.toml",
+			content: `handler = "http"`,
+			err:     "unsupported config file",
+		},
+		{
+			name:    "invalid json",
+			file:    "config.json",
+			content: `{"handler": `,
+			err:     "unable to parse config file",
+		},
+		{
+			name:    "invalid yaml type",
+			file:    "config.yaml",
+			content: "rate_limit: fast\n",
+			err:     "unable to parse config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadConfig(path)
+			if len(tt.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := []string(config.ServerAddress); !reflect.DeepEqual(got, []string{":9090"}) {
+				t.Errorf("server_address = %v", got)
+			}
+			if config.Handler == nil || *config.Handler != "http" {
+				t.Errorf("handler = %v", config.Handler)
+			}
+			if config.ShutdownTimeout == nil || *config.ShutdownTimeout != "15s" {
+				t.Errorf("shutdown_timeout = %v", config.ShutdownTimeout)
+			}
+			if want := []string{"https://a.example.com", "https://b.example.com"}; !reflect.DeepEqual(config.CorsAllowedOrigins, want) {
+				t.Errorf("cors_allowed_origins = %v", config.CorsAllowedOrigins)
+			}
+			if config.Namespace != nil {
+				t.Errorf("namespace = %v, expected unset", *config.Namespace)
+			}
+		})
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `handler: http
+namespace: go.micro.file
+router: static
+shutdown_timeout: 15s
+cors_allowed_origins: [https://file.example.com]
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("MICRO_API_ROUTER", "registry")
+
+	var handler, namespace, router string
+	var timeout time.Duration
+	var origins []string
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "handler", Value: "rpc"},
+			&cli.StringFlag{Name: "namespace"},
+			&cli.StringFlag{Name: "router", EnvVars: []string{"MICRO_API_ROUTER"}},
+			&cli.DurationFlag{Name: "shutdown_timeout", Value: 30 * time.Second},
+			&cli.StringSliceFlag{Name: "cors_allowed_origins"},
+		},
+		Action: func(ctx *cli.Context) error {
+			if err := config.apply(ctx); err != nil {
+				return err
+			}
+			handler = ctx.String("handler")
+			namespace = ctx.String("namespace")
+			router = ctx.String("router")
+			timeout = ctx.Duration("shutdown_timeout")
+			origins = ctx.StringSlice("cors_allowed_origins")
+			return nil
+		},
+	}
+	if err := app.Run([]string{"api", "--handler=web"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// flags and environment variables take precedence over the file
+	if handler != "web" {
+		t.Errorf("handler = %q, expected the flag", handler)
+	}
+	if router != "registry" {
+		t.Errorf("router = %q, expected the environment variable", router)
+	}
+	// unset flags are taken from the file
+	if namespace != "go.micro.file" {
+		t.Errorf("namespace = %q, expected the file", namespace)
+	}
+	if timeout != 15*time.Second {
+		t.Errorf("shutdown_timeout = %v, expected the file", timeout)
+	}
+	if !reflect.DeepEqual(origins, []string{"https://file.example.com"}) {
+		t.Errorf("cors_allowed_origins = %v, expected the file", origins)
+	}
+}
@@ -1,18 +1,195 @@
 package cmd
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go-micro.dev/v4/api/router"
+	"go-micro.dev/v4/errors"
+)
+
+// CorsConfig configures the headers written by the cors middleware
+type CorsConfig struct {
+	// Origins allowed to make cross origin requests, "*" allows any origin
+	AllowedOrigins []string
+	// Methods allowed for cross origin requests
+	AllowedMethods []string
+	// Headers allowed in cross origin requests
+	AllowedHeaders []string
+	// Headers exposed to the client
+	ExposedHeaders []string
+	// Whether credentials are allowed, which requires origins other than "*"
+	AllowCredentials bool
+	// Preflight cache duration in seconds, 0 omits the header
+	MaxAge int
+	// Answer preflights with the requested headers which are allowed rather
+	// than the whole list, a "*" in AllowedHeaders allows any requested header
+	ReflectRequestHeaders bool
+	// Pass preflight requests through to the handler so services answer them
+	PreflightPassthrough bool
+	// Status code of preflight responses, 200 when unset
+	PreflightStatus int
+}
+
+var (
+	DefaultCorsConfig = CorsConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"POST", "GET", "OPTIONS", "DELETE", "PUT"},
+		AllowedHeaders: []string{"Content-Type", "AccessToken", "X-CSRF-Token", "Authorization", "Token", "X-Token", "X-User-Id"},
+		ExposedHeaders: []string{"Content-Length", "Access-Control-Allow-Origin", "Access-Control-Allow-Headers", "Content-Type"},
+	}
+)
 
 func CorsMiddleware(handler http.Handler) http.Handler {
+	return CorsMiddlewareWithConfig(DefaultCorsConfig, handler)
+}
+
+func CorsMiddlewareWithConfig(cfg CorsConfig, handler http.Handler) http.Handler {
+	allowedMethods := strings.Join(cfg.AllowedMethods, ",")
+	allowedHeaders := strings.Join(cfg.AllowedHeaders, ",")
+	exposedHeaders := strings.Join(cfg.ExposedHeaders, ",")
+	// the response depends on the origin unless every origin is allowed alike
+	varyOrigin := len(cfg.AllowedOrigins) != 1 || cfg.AllowedOrigins[0] != "*"
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		writer.Header().Set("Access-Control-Allow-Origin", "*")
-		writer.Header().Set("Access-Control-Allow-Headers", "Content-Type,AccessToken,X-CSRF-Token,Authorization,Token,X-Token,X-User-Id")
-		writer.Header().Set("Access-Control-Allow-Methods", "POST,GET,OPTIONS,DELETE,PUT")
-		writer.Header().Set("Access-Control-Expose-Headers", "Content-Length,Access-Control-Allow-Origin,Access-Control-Allow-Headers,Content-Type")
-		writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		// leave the cors headers to the service answering the preflight
+		if cfg.PreflightPassthrough && request.Method == http.MethodOptions {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		// also when the origin isn't allowed so caches don't serve one response to every origin
+		if varyOrigin {
+			writer.Header().Add("Vary", "Origin")
+		}
+		origin, allowed := cfg.allowOrigin(request.Header.Get("Origin"))
+		if allowed {
+			writer.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if requested := request.Header.Get("Access-Control-Request-Headers"); cfg.ReflectRequestHeaders && len(requested) > 0 {
+			writer.Header().Add("Vary", "Access-Control-Request-Headers")
+			writer.Header().Set("Access-Control-Allow-Headers", cfg.allowHeaders(requested))
+		} else {
+			writer.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+		}
+		writer.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+		writer.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+		// browsers reject credentials with a wildcard origin, so only listed origins get them
+		if cfg.AllowCredentials && allowed && origin != "*" {
+			writer.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
 		if request.Method == http.MethodOptions {
-			writer.WriteHeader(http.StatusOK)
+			if cfg.MaxAge > 0 {
+				writer.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+			}
+			status := cfg.PreflightStatus
+			if status == 0 {
+				status = http.StatusOK
+			}
+			writer.WriteHeader(status)
 			return
 		}
 		handler.ServeHTTP(writer, request)
 	})
 }
+
+// validate reports settings browsers would reject
+func (c CorsConfig) validate() error {
+	if !c.AllowCredentials {
+		return nil
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return fmt.Errorf("cors credentials require allowed origins other than *")
+		}
+	}
+	return nil
+}
+
+// allowOrigin returns the value of Access-Control-Allow-Origin for the request origin.
+// A listed origin is echoed back rather than "*" so credentials are accepted by browsers,
+// while "*" is never turned into the request origin so it can't be sent with credentials.
+func (c CorsConfig) allowOrigin(origin string) (string, bool) {
+	var wildcard bool
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			wildcard = true
+		} else if len(origin) > 0 && matchOrigin(allowed, origin) {
+			return origin, true
+		}
+	}
+	if wildcard {
+		return "*", true
+	}
+	return "", false
+}
+
+// matchOrigin reports whether the origin matches the allowed origin, which may
+// start with a "*." wildcard matching any subdomain, e.g. "*.example.com" or
+// "https://*.example.com". The wildcard does not match the bare domain itself.
+func matchOrigin(allowed, origin string) bool {
+	if strings.EqualFold(allowed, origin) {
+		return true
+	}
+	scheme, host, ok := strings.Cut(allowed, "://")
+	if !ok {
+		scheme, host = "", allowed
+	}
+	if !strings.HasPrefix(host, "*.") {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || len(u.Host) == 0 {
+		return false
+	}
+	if len(scheme) > 0 && !strings.EqualFold(scheme, u.Scheme) {
+		return false
+	}
+	// compare the port too when the pattern names one
+	name := u.Hostname()
+	if strings.Contains(host, ":") {
+		name = u.Host
+	}
+	suffix := host[1:]
+	return len(name) > len(suffix) && strings.HasSuffix(strings.ToLower(name), strings.ToLower(suffix))
+}
+
+// allowHeaders returns the requested headers which are allowed
+func (c CorsConfig) allowHeaders(requested string) string {
+	var headers []string
+	for _, h := range strings.Split(requested, ",") {
+		if h = strings.TrimSpace(h); len(h) == 0 {
+			continue
+		}
+		for _, allowed := range c.AllowedHeaders {
+			if allowed == "*" || strings.EqualFold(allowed, h) {
+				headers = append(headers, h)
+				break
+			}
+		}
+	}
+	return strings.Join(headers, ",")
+}
+
+// PreflightRouteMiddleware answers preflights with a 404 when the request they
+// announce matches no service, so clients don't assume the endpoint exists
+func PreflightRouteMiddleware(rtr router.Router) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			method := request.Header.Get("Access-Control-Request-Method")
+			if request.Method != http.MethodOptions || len(method) == 0 {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			// route the request the preflight is made for
+			announced := request.Clone(request.Context())
+			announced.Method = method
+			if _, err := rtr.Route(announced); err != nil && isNotFound(err) {
+				writeError(writer, errors.NotFound(packageID, "no service matches %v %v", method, request.URL.Path))
+				return
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
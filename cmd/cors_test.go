@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		allowed string
+		origin  string
+		match   bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "HTTPS://EXAMPLE.COM", true},
+		{"https://*.example.com", "https://a.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://a.example.com.evil.com", false},
+		// a pattern without a port allows any port, one with a port only that port
+		{"https://*.example.com", "https://a.example.com:8443", true},
+		{"https://*.example.com:8443", "https://a.example.com:8443", true},
+		{"https://*.example.com:8443", "https://a.example.com:9443", false},
+		{"https://*.example.com:8443", "https://a.example.com", false},
+		{"https://example.com:8443", "https://example.com:9443", false},
+		// the scheme must match when the pattern names one
+		{"https://*.example.com", "http://a.example.com", false},
+		{"https://example.com", "http://example.com", false},
+		{"*.example.com", "http://a.example.com", true},
+		{"*.example.com", "https://a.example.com", true},
+		{"*.example.com", "null", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchOrigin(tt.allowed, tt.origin); got != tt.match {
+			t.Errorf("matchOrigin(%q, %q) = %v, expected %v", tt.allowed, tt.origin, got, tt.match)
+		}
+	}
+}
+
+func TestCorsCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		origin      string
+		allow       string
+		credentials bool
+	}{
+		{name: "listed origin", origins: []string{"https://a.example.com"}, origin: "https://a.example.com", allow: "https://a.example.com", credentials: true},
+		{name: "unlisted origin", origins: []string{"https://a.example.com"}, origin: "https://evil.com"},
+		// embedders may skip validate, the origin must still not be reflected
+		{name: "wildcard", origins: []string{"*"}, origin: "https://evil.com", allow: "*"},
+		{name: "listed ahead of the wildcard", origins: []string{"*", "https://a.example.com"}, origin: "https://a.example.com", allow: "https://a.example.com", credentials: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultCorsConfig
+			cfg.AllowedOrigins = tt.origins
+			cfg.AllowCredentials = true
+			h := CorsMiddlewareWithConfig(cfg, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			request := httptest.NewRequest(http.MethodGet, "/greeter", nil)
+			request.Header.Set("Origin", tt.origin)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allow {
+				t.Errorf("Access-Control-Allow-Origin %q, expected %q", got, tt.allow)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("Access-Control-Allow-Credentials %v, expected %v", got, tt.credentials)
+			}
+		})
+	}
+}
+
+func TestCorsVaryOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins []string
+		origin  string
+		vary    bool
+	}{
+		{name: "any origin", origins: []string{"*"}, origin: "https://a.example.com"},
+		{name: "matching origin", origins: []string{"https://a.example.com"}, origin: "https://a.example.com", vary: true},
+		{name: "other origin", origins: []string{"https://a.example.com"}, origin: "https://b.example.com", vary: true},
+		{name: "no origin", origins: []string{"https://a.example.com"}, vary: true},
+		{name: "wildcard and listed origins", origins: []string{"*", "https://a.example.com"}, origin: "https://b.example.com", vary: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultCorsConfig
+			cfg.AllowedOrigins = tt.origins
+			h := CorsMiddlewareWithConfig(cfg, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+			request := httptest.NewRequest(http.MethodGet, "/greeter", nil)
+			if len(tt.origin) > 0 {
+				request.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+
+			if got := w.Header().Get("Vary") == "Origin"; got != tt.vary {
+				t.Errorf("Vary %q, expected Origin %v", w.Header().Values("Vary"), tt.vary)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"go-micro.dev/v4/api"
+	"go-micro.dev/v4/errors"
+	"go-micro.dev/v4/registry"
+)
+
+type debugService struct {
+	Name      string          `json:"name"`
+	Version   string          `json:"version"`
+	Nodes     int             `json:"nodes"`
+	Endpoints []debugEndpoint `json:"endpoints"`
+}
+
+type debugEndpoint struct {
+	Name    string   `json:"name"`
+	Handler string   `json:"handler,omitempty"`
+	Method  []string `json:"method,omitempty"`
+	Path    []string `json:"path,omitempty"`
+	Host    []string `json:"host,omitempty"`
+}
+
+// RoutesHandler lists the services known to the registry along with the
+// api endpoints they register, for debugging requests that fail to route
+func RoutesHandler(reg registry.Registry) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		list, err := reg.ListServices()
+		if err != nil {
+			writeError(writer, errors.InternalServerError(packageID, "unable to list services: %v", err))
+			return
+		}
+
+		services := []debugService{}
+		for _, s := range list {
+			versions, err := reg.GetService(s.Name)
+			if err != nil {
+				continue
+			}
+			for _, v := range versions {
+				service := debugService{Name: v.Name, Version: v.Version, Nodes: len(v.Nodes), Endpoints: []debugEndpoint{}}
+				for _, ep := range v.Endpoints {
+					endpoint := debugEndpoint{Name: ep.Name}
+					if e := api.Decode(ep.Metadata); e != nil {
+						endpoint.Handler, endpoint.Method, endpoint.Path, endpoint.Host = e.Handler, e.Method, e.Path, e.Host
+					}
+					service.Endpoints = append(service.Endpoints, endpoint)
+				}
+				services = append(services, service)
+			}
+		}
+		sort.Slice(services, func(i, j int) bool {
+			if services[i].Name != services[j].Name {
+				return services[i].Name < services[j].Name
+			}
+			return services[i].Version < services[j].Version
+		})
+
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(map[string]interface{}{"services": services})
+	})
+}
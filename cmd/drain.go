@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go-micro.dev/v4/errors"
+)
+
+// inflight counts the requests being served so shutdown can wait for them,
+// including hijacked connections the http server no longer tracks
+type inflight struct {
+	count int64
+}
+
+func (i *inflight) Middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt64(&i.count, 1)
+		defer atomic.AddInt64(&i.count, -1)
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// Count returns the number of requests in flight
+func (i *inflight) Count() int64 {
+	return atomic.LoadInt64(&i.count)
+}
+
+// Wait blocks until no requests are in flight or the context is done
+func (i *inflight) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for i.Count() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// DrainHandler starts a graceful shutdown on POST, for orchestrators calling
+// http lifecycle hooks rather than sending signals
+func DrainHandler(drain chan<- struct{}) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			writer.Header().Set("Allow", http.MethodPost)
+			writeError(writer, errors.MethodNotAllowed(packageID, "drain requires POST"))
+			return
+		}
+		// a shutdown may already be pending
+		select {
+		case drain <- struct{}{}:
+		default:
+		}
+		writeStatus(writer, http.StatusAccepted, "draining", "")
+	})
+}
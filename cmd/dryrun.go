@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// summary describes the gateway assembled by Before, printed by --dry_run
+type summary struct {
+	addresses  []string
+	router     string
+	resolver   string
+	handler    string
+	namespace  string
+	middleware []string
+	endpoints  []string
+}
+
+// printSummary writes the resolved configuration in the "key: value" format of the version command
+func (c *cmd) printSummary(w io.Writer) {
+	fmt.Fprintf(w, "name: %s\n", c.app.Name)
+	fmt.Fprintf(w, "version: %s\n", orUnknown(c.opts.Version))
+	fmt.Fprintf(w, "address: %s\n", strings.Join(c.summary.addresses, ", "))
+	fmt.Fprintf(w, "router: %s\n", c.summary.router)
+	fmt.Fprintf(w, "resolver: %s\n", c.summary.resolver)
+	fmt.Fprintf(w, "handler: %s\n", c.summary.handler)
+	fmt.Fprintf(w, "namespace: %s\n", c.summary.namespace)
+	fmt.Fprintf(w, "middleware: %s\n", strings.Join(c.summary.middleware, ", "))
+	fmt.Fprintf(w, "endpoints:\n")
+	for _, endpoint := range c.summary.endpoints {
+		fmt.Fprintf(w, "  %s\n", endpoint)
+	}
+}
+
+// logBanner reports the settings the gateway came up with once it's listening, as a
+// single json record with --log_format=json and a short block of text otherwise
+func (c *cmd) logBanner(w io.Writer, format string) {
+	addresses := []string{(*c.opts.Server).Address()}
+	for _, l := range c.listeners {
+		addresses = append(addresses, l.Address())
+	}
+	if format == "json" {
+		logEvent(c.logger, "Gateway ready", map[string]interface{}{
+			"name":       c.app.Name,
+			"version":    orUnknown(c.opts.Version),
+			"addresses":  addresses,
+			"router":     c.summary.router,
+			"resolver":   c.summary.resolver,
+			"handler":    c.summary.handler,
+			"namespace":  c.summary.namespace,
+			"middleware": c.summary.middleware,
+		})
+		return
+	}
+	fmt.Fprintf(w, "%s %s ready\n", c.app.Name, orUnknown(c.opts.Version))
+	fmt.Fprintf(w, "  address:    %s\n", strings.Join(addresses, ", "))
+	fmt.Fprintf(w, "  router:     %s, resolver: %s, handler: %s\n", c.summary.router, c.summary.resolver, c.summary.handler)
+	fmt.Fprintf(w, "  namespace:  %s\n", c.summary.namespace)
+	fmt.Fprintf(w, "  middleware: %s\n", strings.Join(c.summary.middleware, ", "))
+}
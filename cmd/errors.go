@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"go-micro.dev/v4/errors"
+)
+
+// id used for errors originating in the gateway, matching the go-micro handlers
+const packageID = "go.micro.api"
+
+// writeError writes the error as a go-micro json error response
+func writeError(writer http.ResponseWriter, err error) {
+	ce := errors.Parse(err.Error())
+	if ce.Code == 0 {
+		ce.Code = http.StatusInternalServerError
+		ce.Status = http.StatusText(http.StatusInternalServerError)
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(int(ce.Code))
+	writer.Write([]byte(ce.Error()))
+}
+
+// largest error body held back to be normalized, larger bodies pass through
+const maxErrorBody = 64 << 10
+
+// gatewayErrorIDs are the ids of errors raised by the gateway rather than a service
+var gatewayErrorIDs = map[string]bool{
+	packageID:         true,
+	"go.micro.client": true,
+}
+
+// NormalizeErrorsMiddleware renders errors raised by the gateway, such as routing
+// failures, timeouts or rejected credentials, as {"error":{"code":...,"message":...}}.
+// Errors returned by services pass through unchanged, those without a body are
+// given one with the status text as message.
+func NormalizeErrorsMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ew := &errorWriter{ResponseWriter: writer, head: request.Method == http.MethodHead}
+		handler.ServeHTTP(ew, request)
+		ew.finish()
+	})
+}
+
+// errorWriter holds back error responses until they are complete so they can be replaced
+type errorWriter struct {
+	http.ResponseWriter
+	head bool
+
+	code        int
+	body        []byte
+	buffering   bool
+	wroteHeader bool
+}
+
+func (ew *errorWriter) WriteHeader(code int) {
+	if ew.wroteHeader {
+		return
+	}
+	ew.wroteHeader = true
+	if code >= http.StatusBadRequest && !ew.head {
+		ew.code = code
+		ew.buffering = true
+		return
+	}
+	ew.ResponseWriter.WriteHeader(code)
+}
+
+func (ew *errorWriter) Write(b []byte) (int, error) {
+	ew.WriteHeader(http.StatusOK)
+	if !ew.buffering {
+		return ew.ResponseWriter.Write(b)
+	}
+	if len(ew.body)+len(b) > maxErrorBody {
+		if err := ew.passThrough(); err != nil {
+			return 0, err
+		}
+		return ew.ResponseWriter.Write(b)
+	}
+	ew.body = append(ew.body, b...)
+	return len(b), nil
+}
+
+// Flush gives up on normalizing a streamed error
+func (ew *errorWriter) Flush() {
+	if ew.buffering {
+		ew.passThrough()
+	}
+	flush(ew.ResponseWriter)
+}
+
+func (ew *errorWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(ew.ResponseWriter)
+}
+
+func (ew *errorWriter) Push(target string, opts *http.PushOptions) error {
+	return push(ew.ResponseWriter, target, opts)
+}
+
+func (ew *errorWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// passThrough writes the held back response as it is
+func (ew *errorWriter) passThrough() error {
+	ew.buffering = false
+	ew.ResponseWriter.WriteHeader(ew.code)
+	_, err := ew.ResponseWriter.Write(ew.body)
+	ew.body = nil
+	return err
+}
+
+// finish writes the held back error, normalized when raised by the gateway
+func (ew *errorWriter) finish() {
+	if !ew.buffering {
+		return
+	}
+	ce := errors.Parse(string(ew.body))
+	if len(ew.body) > 0 && !gatewayErrorIDs[ce.Id] {
+		ew.passThrough()
+		return
+	}
+	message := ce.Detail
+	if len(ew.body) == 0 {
+		message = http.StatusText(ew.code)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{"code": ew.code, "message": message},
+	})
+	header := ew.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/json")
+	ew.buffering = false
+	ew.ResponseWriter.WriteHeader(ew.code)
+	ew.ResponseWriter.Write(body)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"go-micro.dev/v4/api/router"
+	"go-micro.dev/v4/errors"
+	log "go-micro.dev/v4/logger"
+)
+
+// FallbackHandler serves requests matching a service with the handler and
+// reverse proxies requests no service matches to the fallback upstream
+func FallbackHandler(rtr router.Router, handler http.Handler, fallback *url.URL) http.Handler {
+	proxy := httputil.NewSingleHostReverseProxy(fallback)
+	director := proxy.Director
+	proxy.Director = func(request *http.Request) {
+		director(request)
+		request.Host = fallback.Host
+		// the proxy appends the client to X-Forwarded-For
+		if prior, ok := priorForwardedFor(request.Context()); ok {
+			request.Header.Del("X-Forwarded-For")
+			if len(prior) > 0 {
+				request.Header["X-Forwarded-For"] = prior
+			}
+		}
+	}
+	proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, err error) {
+		requestLogger(request.Context()).Logf(log.WarnLevel, "Fallback request to %v failed: %v", fallback, err)
+		writeError(writer, errors.New(packageID, "fallback upstream unavailable", http.StatusBadGateway))
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if _, ok := RouteFromContext(request.Context()); ok {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		if _, err := rtr.Route(request); err != nil && isNotFound(err) {
+			proxy.ServeHTTP(writer, request)
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// isNotFound reports whether a routing error means no service matched, the
+// routers and resolvers return plain "not found" errors rather than a sentinel
+func isNotFound(err error) bool {
+	return strings.Contains(err.Error(), "not found")
+}
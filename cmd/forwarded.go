@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type forwardedKey struct{}
+
+// ForwardedHeadersMiddleware sets X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host
+// for services behind the gateway. The client address is appended to an existing
+// X-Forwarded-For chain, unless reverseProxy is set for handlers whose reverse proxy
+// appends it already. The proto and host sent by trusted proxies are kept, otherwise
+// they are set from the connection and whether tls was terminated by the gateway.
+func ForwardedHeadersMiddleware(trusted []net.IPNet, reverseProxy bool) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			host, _, err := net.SplitHostPort(request.RemoteAddr)
+			if err != nil {
+				host = request.RemoteAddr
+			}
+			if !reverseProxy && len(host) > 0 {
+				prior := request.Header.Values("X-Forwarded-For")
+				request.Header.Set("X-Forwarded-For", strings.Join(append(prior[:len(prior):len(prior)], host), ", "))
+				// reverse proxied by the fallback, which appends the client itself
+				request = request.WithContext(context.WithValue(request.Context(), forwardedKey{}, prior))
+			}
+			trustedPeer := isTrusted(host, trusted)
+			if !trustedPeer || len(request.Header.Get("X-Forwarded-Proto")) == 0 {
+				proto := "http"
+				if request.TLS != nil {
+					proto = "https"
+				}
+				request.Header.Set("X-Forwarded-Proto", proto)
+			}
+			if !trustedPeer || len(request.Header.Get("X-Forwarded-Host")) == 0 {
+				request.Header.Set("X-Forwarded-Host", request.Host)
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// priorForwardedFor returns the X-Forwarded-For values the request arrived with
+// when ForwardedHeadersMiddleware appended the client to them
+func priorForwardedFor(ctx context.Context) ([]string, bool) {
+	prior, ok := ctx.Value(forwardedKey{}).([]string)
+	return prior, ok
+}
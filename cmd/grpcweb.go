@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+
+	"go-micro.dev/v4/api/router"
+	"golang.org/x/net/http2"
+)
+
+// content type of grpc-web requests, the -text variant is base64 encoded
+const grpcWebType = "application/grpc-web"
+
+// grpc status codes returned by the gateway
+const (
+	grpcUnimplemented = 12
+	grpcUnavailable   = 14
+)
+
+// headers not passed between the grpc-web and grpc requests
+var grpcWebSkipHeaders = map[string]bool{
+	"Content-Type":   true,
+	"Content-Length": true,
+	"Connection":     true,
+	"Accept":         true,
+	"Te":             true,
+	"Trailer":        true,
+	"X-Grpc-Web":     true,
+}
+
+// grpcWebAllowedHeaders adds the headers browsers send with grpc-web requests to
+// the cors allowed headers
+func grpcWebAllowedHeaders(headers []string) []string {
+	return append(append([]string{}, headers...), "X-Grpc-Web", "X-User-Agent", "Grpc-Timeout")
+}
+
+// GRPCWebHandler translates grpc-web requests from browsers into grpc calls to a node of the
+// resolved service over cleartext HTTP/2, framing the grpc trailers into the response body.
+// Other requests are passed to the handler.
+func GRPCWebHandler(rtr router.Router, handler http.Handler) http.Handler {
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		contentType := request.Header.Get("Content-Type")
+		if !strings.HasPrefix(contentType, grpcWebType) || request.Method != http.MethodPost {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		// application/grpc-web-text+proto is encoded text with the proto codec
+		subtype := strings.TrimPrefix(contentType, grpcWebType)
+		text := strings.HasPrefix(subtype, "-text")
+		codec := strings.TrimPrefix(subtype, "-text")
+
+		route, err := rtr.Route(request)
+		if err != nil {
+			writeGRPCStatus(writer, contentType, grpcUnimplemented, err.Error())
+			return
+		}
+		var nodes []string
+		for _, service := range route.Versions {
+			for _, node := range service.Nodes {
+				nodes = append(nodes, node.Address)
+			}
+		}
+		if len(nodes) == 0 {
+			writeGRPCStatus(writer, contentType, grpcUnavailable, "service "+route.Service+" has no nodes")
+			return
+		}
+
+		var body io.Reader = request.Body
+		if text {
+			body = base64.NewDecoder(base64.StdEncoding, request.Body)
+		}
+		target := "http://" + nodes[rand.Intn(len(nodes))] + request.URL.Path
+		out, err := http.NewRequestWithContext(request.Context(), http.MethodPost, target, body)
+		if err != nil {
+			writeGRPCStatus(writer, contentType, grpcUnavailable, err.Error())
+			return
+		}
+		copyGRPCHeaders(out.Header, request.Header)
+		out.Header.Set("Content-Type", "application/grpc"+codec)
+		out.Header.Set("Te", "trailers")
+
+		rsp, err := transport.RoundTrip(out)
+		if err != nil {
+			writeGRPCStatus(writer, contentType, grpcUnavailable, err.Error())
+			return
+		}
+		defer rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK {
+			writeGRPCStatus(writer, contentType, grpcUnavailable, fmt.Sprintf("service responded with %s", rsp.Status))
+			return
+		}
+
+		copyGRPCHeaders(writer.Header(), rsp.Header)
+		writer.Header().Set("Content-Type", contentType)
+		writer.WriteHeader(http.StatusOK)
+
+		write := func(b []byte) error {
+			if text {
+				b = []byte(base64.StdEncoding.EncodeToString(b))
+			}
+			if _, err := writer.Write(b); err != nil {
+				return err
+			}
+			flush(writer)
+			return nil
+		}
+		// pass the messages through as they arrive for server streams
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := rsp.Body.Read(buf)
+			if n > 0 {
+				if werr := write(buf[:n]); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+
+		// a trailers only response carries the status in the headers already
+		if len(rsp.Trailer) == 0 {
+			return
+		}
+		var trailer bytes.Buffer
+		for k, v := range rsp.Trailer {
+			for _, value := range v {
+				fmt.Fprintf(&trailer, "%s: %s\r\n", strings.ToLower(k), value)
+			}
+		}
+		frame := make([]byte, 5, 5+trailer.Len())
+		frame[0] = 0x80
+		binary.BigEndian.PutUint32(frame[1:], uint32(trailer.Len()))
+		write(append(frame, trailer.Bytes()...))
+	})
+}
+
+func copyGRPCHeaders(dst, src http.Header) {
+	for k, v := range src {
+		if !grpcWebSkipHeaders[http.CanonicalHeaderKey(k)] {
+			dst[k] = v
+		}
+	}
+}
+
+// writeGRPCStatus writes a trailers only response with the status in the headers
+func writeGRPCStatus(writer http.ResponseWriter, contentType string, code int, message string) {
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("Grpc-Status", fmt.Sprint(code))
+	writer.Header().Set("Grpc-Message", grpcMessage(message))
+	writer.WriteHeader(http.StatusOK)
+}
+
+// grpcMessage percent encodes the message as required for the grpc-message header
+func grpcMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
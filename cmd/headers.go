@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseHeaders parses "Name: Value" pairs into a header
+func parseHeaders(values []string) (http.Header, error) {
+	header := make(http.Header)
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || len(name) == 0 {
+			return nil, fmt.Errorf("invalid header %q, expected Name: Value", value)
+		}
+		header.Add(name, strings.TrimSpace(parts[1]))
+	}
+	return header, nil
+}
+
+// RequestHeaderMiddleware removes and then sets request headers before the request is
+// routed, e.g. stripping Cookie for a public api or marking requests with X-Gateway
+func RequestHeaderMiddleware(set http.Header, remove []string) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			for _, name := range remove {
+				request.Header.Del(name)
+			}
+			for k, v := range set {
+				request.Header[k] = append([]string(nil), v...)
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// ResponseHeaderMiddleware adds the headers to every response as it is written so they
+// apply to backend responses too. Headers the backend set are replaced when overwrite
+// is true, otherwise the values are appended.
+func ResponseHeaderMiddleware(header http.Header, overwrite bool) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			handler.ServeHTTP(&headerWriter{ResponseWriter: writer, header: header, overwrite: overwrite}, request)
+		})
+	}
+}
+
+// StripResponseHeaderMiddleware removes the named headers from responses, e.g. Server or
+// X-Powered-By set by backends. Names are matched case-insensitively.
+func StripResponseHeaderMiddleware(names []string) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			handler.ServeHTTP(&headerWriter{ResponseWriter: writer, remove: names}, request)
+		})
+	}
+}
+
+// headerWriter applies the headers just before the response header is written
+type headerWriter struct {
+	http.ResponseWriter
+	header    http.Header
+	overwrite bool
+	remove    []string
+	applied   bool
+}
+
+func (w *headerWriter) apply() {
+	if w.applied {
+		return
+	}
+	w.applied = true
+	dst := w.ResponseWriter.Header()
+	for _, name := range w.remove {
+		dst.Del(name)
+	}
+	for k, v := range w.header {
+		if w.overwrite {
+			dst[k] = append([]string(nil), v...)
+		} else {
+			dst[k] = append(dst[k], v...)
+		}
+	}
+}
+
+func (w *headerWriter) WriteHeader(code int) {
+	w.apply()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headerWriter) Flush() {
+	w.apply()
+	flush(w.ResponseWriter)
+}
+
+func (w *headerWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(w.ResponseWriter)
+}
+
+func (w *headerWriter) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go-micro.dev/v4/registry"
+)
+
+// HealthHandler answers liveness probes without going through the router
+func HealthHandler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writeStatus(writer, http.StatusOK, "ok", "")
+	})
+}
+
+// ReadyHandler answers readiness probes, failing until the registry
+// is reachable and at least one service has been discovered
+func ReadyHandler(reg registry.Registry) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		services, err := reg.ListServices()
+		if err != nil {
+			writeStatus(writer, http.StatusServiceUnavailable, "unavailable", err.Error())
+			return
+		}
+		if len(services) == 0 {
+			writeStatus(writer, http.StatusServiceUnavailable, "unavailable", "no services discovered")
+			return
+		}
+		writeStatus(writer, http.StatusOK, "ok", "")
+	})
+}
+
+func writeStatus(writer http.ResponseWriter, code int, status, reason string) {
+	body := map[string]string{"status": status}
+	if len(reason) > 0 {
+		body["error"] = reason
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(code)
+	json.NewEncoder(writer).Encode(body)
+}
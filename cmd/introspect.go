@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"go-micro.dev/v4/errors"
+)
+
+// flags whose values are never served by the config endpoint
+var secretFlags = map[string]bool{
+	"auth_token": true,
+	"tls_key":    true,
+}
+
+// effectiveFlags returns the value of every flag keyed by name, with secrets,
+// the values of injected request headers and url credentials redacted
+func effectiveFlags(ctx *cli.Context) map[string]interface{} {
+	flags := make(map[string]interface{})
+	for _, flag := range ctx.App.Flags {
+		name := flag.Names()[0]
+		switch flag.(type) {
+		case *cli.StringSliceFlag:
+			values := splitList(ctx.StringSlice(name))
+			if name == "request_header_set" {
+				values = redactHeaders(values)
+			}
+			list := make([]string, 0, len(values))
+			for _, value := range values {
+				list = append(list, redactURL(value))
+			}
+			flags[name] = list
+		case *cli.DurationFlag:
+			flags[name] = ctx.Duration(name).String()
+		case *cli.StringFlag:
+			value := ctx.String(name)
+			if secretFlags[name] && len(value) > 0 {
+				value = redacted
+			}
+			flags[name] = redactURL(value)
+		default:
+			flags[name] = ctx.Value(name)
+		}
+	}
+	return flags
+}
+
+// redactHeaders masks the values of "Name: Value" headers
+func redactHeaders(values []string) []string {
+	headers := make([]string, len(values))
+	for i, value := range values {
+		headers[i] = strings.SplitN(value, ":", 2)[0] + ": " + redacted
+	}
+	return headers
+}
+
+// redactURL masks the password of a url, leaving other values as they are
+func redactURL(value string) string {
+	if !strings.Contains(value, "://") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	return u.Redacted()
+}
+
+// configHandler serves the effective configuration, the components selected by
+// Before along with the flags, as json
+func (c *cmd) configHandler(flags map[string]interface{}) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet && request.Method != http.MethodHead {
+			writer.Header().Set("Allow", "GET, HEAD")
+			writeError(writer, errors.MethodNotAllowed(packageID, "config requires GET"))
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(map[string]interface{}{
+			"name":       c.app.Name,
+			"version":    orUnknown(c.opts.Version),
+			"addresses":  c.summary.addresses,
+			"router":     c.summary.router,
+			"resolver":   c.summary.resolver,
+			"handler":    c.summary.handler,
+			"middleware": c.summary.middleware,
+			"endpoints":  c.summary.endpoints,
+			"flags":      flags,
+		})
+	})
+}
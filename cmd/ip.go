@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the originating client address. X-Forwarded-For is only honoured
+// when the request arrives from a trusted proxy, in which case hops are walked from
+// the right skipping trusted proxies. Without trusted proxies RemoteAddr is used.
+func ClientIP(request *http.Request, trusted []net.IPNet) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	if !isTrusted(host, trusted) {
+		return host
+	}
+	var hops []string
+	for _, xff := range request.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(xff, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if len(hop) == 0 {
+			continue
+		}
+		host = hop
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+	return host
+}
+
+// isTrusted reports whether the ip is within one of the trusted networks
+func isTrusted(ip string, trusted []net.IPNet) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetworks parses a list of CIDRs, a bare ip is treated as a single address
+func parseNetworks(values []string) ([]net.IPNet, error) {
+	var networks []net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", value)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			networks = append(networks, net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q", value)
+		}
+		networks = append(networks, *network)
+	}
+	return networks, nil
+}
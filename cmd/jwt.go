@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go-micro.dev/v4/errors"
+)
+
+const (
+	// headers carrying validated claims to the backend
+	jwtSubjectHeader = "X-Jwt-Subject"
+	jwtScopeHeader   = "X-Jwt-Scope"
+)
+
+var (
+	// how long fetched keys are trusted before being refreshed
+	jwksRefreshInterval = time.Hour
+	// minimum time between refreshes triggered by an unknown key id
+	jwksMinRefreshInterval = time.Minute
+)
+
+// JWKS is a cache of the public keys published at a JWKS url
+type JWKS struct {
+	url    string
+	client *http.Client
+
+	mtx     sync.RWMutex
+	keys    map[string]interface{}
+	fetched time.Time
+	// the last refresh, successful or not, and its error
+	attempted time.Time
+	err       error
+	// closed when the refresh in progress completes, nil while idle
+	refreshing chan struct{}
+}
+
+func NewJWKS(url string) *JWKS {
+	return &JWKS{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]interface{}),
+	}
+}
+
+// Key returns the key with the given id, refreshing the set when the key is unknown
+// or the cache is stale so rotated keys are picked up. Refreshes are at least
+// jwksMinRefreshInterval apart, failed ones included, so tokens with made up key ids
+// can't flood the endpoint.
+func (j *JWKS) Key(kid string) (interface{}, error) {
+	j.mtx.RLock()
+	key, ok := j.keys[kid]
+	age := time.Since(j.fetched)
+	attempted := time.Since(j.attempted)
+	j.mtx.RUnlock()
+
+	if ok && age < jwksRefreshInterval {
+		return key, nil
+	}
+	if attempted < jwksMinRefreshInterval {
+		if ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	if err := j.refresh(); err != nil {
+		// keep serving known keys while the endpoint is unavailable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	j.mtx.RLock()
+	defer j.mtx.RUnlock()
+	if key, ok := j.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// refresh fetches the key set, callers arriving while a refresh is in progress or
+// within jwksMinRefreshInterval of the last one share its outcome
+func (j *JWKS) refresh() error {
+	j.mtx.Lock()
+	if done := j.refreshing; done != nil {
+		j.mtx.Unlock()
+		<-done
+		j.mtx.RLock()
+		defer j.mtx.RUnlock()
+		return j.err
+	}
+	if time.Since(j.attempted) < jwksMinRefreshInterval {
+		defer j.mtx.Unlock()
+		return j.err
+	}
+	done := make(chan struct{})
+	j.refreshing = done
+	j.mtx.Unlock()
+
+	keys, err := j.fetch()
+
+	j.mtx.Lock()
+	j.attempted = time.Now()
+	j.err = err
+	if err == nil {
+		j.keys = keys
+		j.fetched = j.attempted
+	}
+	j.refreshing = nil
+	j.mtx.Unlock()
+	close(done)
+	return err
+}
+
+func (j *JWKS) fetch() (map[string]interface{}, error) {
+	rsp, err := j.client.Get(j.url)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v fetching %v", rsp.Status, j.url)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// a point off the curve is never a valid key
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("key %q is not on curve %v", k.Kid, k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// JWTMiddleware validates the bearer JWT of each request against the key set and passes
+// the sub and scope claims to the backend as headers. Preflight requests are exempt.
+func JWTMiddleware(jwks *JWKS) func(http.Handler) http.Handler {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}))
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return jwks.Key(kid)
+	}
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.Method == http.MethodOptions {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+
+			// never trust claims sent by the client
+			request.Header.Del(jwtSubjectHeader)
+			request.Header.Del(jwtScopeHeader)
+
+			token, ok := bearerToken(request)
+			if !ok {
+				writer.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(writer, errors.Unauthorized(packageID, "missing bearer token"))
+				return
+			}
+
+			claims := jwt.MapClaims{}
+			if _, err := parser.ParseWithClaims(token, claims, keyFunc); err != nil {
+				writer.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(writer, errors.Unauthorized(packageID, "invalid token: %v", err))
+				return
+			}
+
+			if sub, ok := claims["sub"].(string); ok {
+				request.Header.Set(jwtSubjectHeader, sub)
+			}
+			switch scope := claims["scope"].(type) {
+			case string:
+				request.Header.Set(jwtScopeHeader, scope)
+			case []interface{}:
+				var scopes []string
+				for _, s := range scope {
+					scopes = append(scopes, fmt.Sprint(s))
+				}
+				request.Header.Set(jwtScopeHeader, strings.Join(scopes, " "))
+			}
+
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestJWKSRefreshThrottled(t *testing.T) {
+	var hits int32
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	jwks := NewJWKS(srv.URL)
+
+	// concurrent misses for made up key ids share one refresh
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := jwks.Key(fmt.Sprintf("forged-%d", i)); err == nil {
+				t.Error("expected an error for an unknown key")
+			}
+		}(i)
+	}
+	<-started
+	close(release)
+	wg.Wait()
+
+	// a failed refresh counts towards the minimum interval
+	if _, err := jwks.Key("forged-again"); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatalf("expected 1 request to the JWKS endpoint, got %d", n)
+	}
+}
+
+func TestJWKSCurvePoint(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	key := jsonWebKey{Kty: "EC", Kid: "ec", Crv: "P-256", X: encode(priv.X.Bytes()), Y: encode(priv.Y.Bytes())}
+	if _, err := key.publicKey(); err != nil {
+		t.Fatalf("valid key rejected: %v", err)
+	}
+
+	y := priv.Y.Bytes()
+	y[len(y)-1] ^= 1
+	key.Y = encode(y)
+	if _, err := key.publicKey(); err == nil {
+		t.Fatal("expected a point off the curve to be rejected")
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"go-micro.dev/v4/errors"
+)
+
+// BodyLimitMiddleware rejects request bodies larger than limit bytes with a 413.
+// Bodies of unknown length are cut off once the limit is read, which is answered
+// with a 413 when the gateway buffers the body, e.g. for retries.
+func BodyLimitMiddleware(limit int64) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		if limit <= 0 {
+			return handler
+		}
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.ContentLength > limit {
+				writeError(writer, errors.New(packageID, fmt.Sprintf("request body exceeds %d bytes", limit), http.StatusRequestEntityTooLarge))
+				return
+			}
+			request.Body = &limitedBody{ReadCloser: http.MaxBytesReader(writer, request.Body, limit), limit: limit}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// bodyTooLargeError is returned reading a body cut off by BodyLimitMiddleware
+type bodyTooLargeError struct {
+	limit int64
+}
+
+func (e bodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body exceeds %d bytes", e.limit)
+}
+
+// limitedBody reports the error of http.MaxBytesReader as a bodyTooLargeError, as
+// the reader fails once more than the limit is read
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		err = bodyTooLargeError{b.limit}
+	}
+	return n, err
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBodyLimitChunked(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("body not buffered: %v", err)
+		}
+		w.Write(b)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		buffer func(http.Handler) http.Handler
+		status int
+	}{
+		{name: "buffered within the limit", method: http.MethodPost, body: "small", buffer: BufferBodyMiddleware(0), status: http.StatusOK},
+		{name: "buffered over the limit", method: http.MethodPost, body: strings.Repeat("x", 64), buffer: BufferBodyMiddleware(0), status: http.StatusRequestEntityTooLarge},
+		{name: "retried over the limit", method: http.MethodGet, body: strings.Repeat("x", 64), buffer: RetryMiddleware(1, time.Millisecond), status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := BodyLimitMiddleware(16)(tt.buffer(echo))
+
+			// a reader of unknown length is sent chunked
+			request := httptest.NewRequest(tt.method, "/greeter", io.MultiReader(strings.NewReader(tt.body)))
+			request.ContentLength = -1
+			request.TransferEncoding = []string{"chunked"}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, request)
+
+			if w.Code != tt.status {
+				t.Fatalf("status %d, expected %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.body {
+				t.Fatalf("body %q, expected %q", w.Body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// connCounter counts the open connections accepted by the listeners it wraps
+type connCounter struct {
+	count int64
+}
+
+// Listener wraps the listener counting its connections until they are closed
+func (c *connCounter) Listener(l net.Listener) net.Listener {
+	return &countListener{Listener: l, counter: c}
+}
+
+// Count returns the number of open connections
+func (c *connCounter) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
+
+type countListener struct {
+	net.Listener
+	counter *connCounter
+}
+
+func (l *countListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&l.counter.count, 1)
+	return &countConn{Conn: conn, counter: l.counter}, nil
+}
+
+type countConn struct {
+	net.Conn
+	counter *connCounter
+	once    sync.Once
+}
+
+func (c *countConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		atomic.AddInt64(&c.counter.count, -1)
+	})
+	return err
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "go-micro.dev/v4/logger"
+)
+
+// jsonLogger is a go-micro logger writing each record as a single json line
+type jsonLogger struct {
+	mtx  sync.RWMutex
+	opts log.Options
+}
+
+func newJSONLogger(opts ...log.Option) log.Logger {
+	l := &jsonLogger{opts: log.Options{
+		Level:  log.InfoLevel,
+		Fields: make(map[string]interface{}),
+		Out:    os.Stdout,
+	}}
+	l.Init(opts...)
+	return l
+}
+
+func (l *jsonLogger) Init(opts ...log.Option) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for _, o := range opts {
+		o(&l.opts)
+	}
+	return nil
+}
+
+func (l *jsonLogger) Options() log.Options {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return l.opts
+}
+
+func (l *jsonLogger) Fields(fields map[string]interface{}) log.Logger {
+	l.mtx.RLock()
+	opts := l.opts
+	nfields := make(map[string]interface{}, len(opts.Fields)+len(fields))
+	for k, v := range opts.Fields {
+		nfields[k] = v
+	}
+	l.mtx.RUnlock()
+	for k, v := range fields {
+		nfields[k] = v
+	}
+	opts.Fields = nfields
+	return &jsonLogger{opts: opts}
+}
+
+func (l *jsonLogger) Log(level log.Level, v ...interface{}) {
+	l.write(level, fmt.Sprint(v...))
+}
+
+func (l *jsonLogger) Logf(level log.Level, format string, v ...interface{}) {
+	l.write(level, fmt.Sprintf(format, v...))
+}
+
+func (l *jsonLogger) write(level log.Level, msg string) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	if !l.opts.Level.Enabled(level) {
+		return
+	}
+	record := make(map[string]interface{}, len(l.opts.Fields)+3)
+	for k, v := range l.opts.Fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		record[k] = v
+	}
+	record["time"] = time.Now().Format(time.RFC3339Nano)
+	record["level"] = level.String()
+	record["msg"] = msg
+	b, err := json.Marshal(record)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"level": level.String(), "msg": msg})
+	}
+	l.opts.Out.Write(append(b, '\n'))
+}
+
+func (l *jsonLogger) String() string {
+	return "json"
+}
+
+// logEvent logs a lifecycle event with its fields, structured when --log_format=json
+func logEvent(logger log.Logger, msg string, fields map[string]interface{}) {
+	logger.Fields(fields).Log(log.InfoLevel, msg)
+}
+
+// syncLogger is the logger of one gateway, locked so the level can be changed on
+// reload while it's in use as go-micro's default logger isn't safe to Init
+type syncLogger struct {
+	mtx sync.RWMutex
+	log.Logger
+}
+
+func (l *syncLogger) Init(opts ...log.Option) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.Logger.Init(opts...)
+}
+
+func (l *syncLogger) Options() log.Options {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return l.Logger.Options()
+}
+
+// Fields returns a copy with the fields, which is never reconfigured so isn't locked
+func (l *syncLogger) Fields(fields map[string]interface{}) log.Logger {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return l.Logger.Fields(fields)
+}
+
+func (l *syncLogger) Log(level log.Level, v ...interface{}) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	l.Logger.Log(level, v...)
+}
+
+func (l *syncLogger) Logf(level log.Level, format string, v ...interface{}) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	l.Logger.Logf(level, format, v...)
+}
+
+type loggerKey struct{}
+
+// loggerMiddleware makes the logger of the gateway available to the middleware
+// serving the request
+func loggerMiddleware(logger log.Logger) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			handler.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), loggerKey{}, logger)))
+		})
+	}
+}
+
+// requestLogger returns the logger of the gateway serving the request, or the
+// default logger when the middleware is used on its own
+func requestLogger(ctx context.Context) log.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(log.Logger); ok {
+		return logger
+	}
+	return log.DefaultLogger
+}
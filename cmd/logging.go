@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	log "go-micro.dev/v4/logger"
+)
+
+// LoggingMiddleware logs the method, path, status and latency of each request
+// along with the request id when one is set
+func LoggingMiddleware(handler http.Handler) http.Handler {
+	return LoggingMiddlewareWithProxies(nil)(handler)
+}
+
+// LoggingMiddlewareWithProxies is LoggingMiddleware resolving the client ip
+// through X-Forwarded-For for requests from trusted proxies
+func LoggingMiddlewareWithProxies(trusted []net.IPNet) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return loggingHandler(handler, trusted)
+	}
+}
+
+func loggingHandler(handler http.Handler, trusted []net.IPNet) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		rw := newResponseWriter(writer)
+		handler.ServeHTTP(rw, request)
+		logger := requestLogger(request.Context())
+		if id, ok := RequestIDFromContext(request.Context()); ok {
+			logger = logger.Fields(map[string]interface{}{"request_id": id})
+		}
+		if path := originalPath(request); path != request.URL.Path {
+			logger = logger.Fields(map[string]interface{}{"original_path": path})
+		}
+		logger.Logf(log.InfoLevel, "client=%s method=%s path=%s status=%d size=%d latency=%s",
+			ClientIP(request, trusted), request.Method, request.URL.Path, rw.status, rw.size, time.Since(start))
+	})
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"go-micro.dev/v4/errors"
+)
+
+// maintenance answers proxied requests with a 503 while enabled, e.g. during
+// database migrations. It may be toggled at runtime by its admin endpoint.
+type maintenance struct {
+	enabled int32
+	message string
+}
+
+func newMaintenance(enabled bool, message string) *maintenance {
+	m := &maintenance{message: message}
+	m.Set(enabled)
+	return m
+}
+
+// Set enables or disables maintenance mode
+func (m *maintenance) Set(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&m.enabled, v)
+}
+
+// Enabled reports whether maintenance mode is enabled
+func (m *maintenance) Enabled() bool {
+	return atomic.LoadInt32(&m.enabled) == 1
+}
+
+func (m *maintenance) Middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if m.Enabled() {
+			writeError(writer, errors.New(packageID, m.message, http.StatusServiceUnavailable))
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// Health reports the gateway as degraded while in maintenance, still
+// answering 200 so liveness probes don't restart it
+func (m *maintenance) Health(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if m.Enabled() {
+			writeStatus(writer, http.StatusOK, "degraded", m.message)
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// Handler reports maintenance mode on GET, enables it on POST and disables it on DELETE
+func (m *maintenance) Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			m.Set(true)
+		case http.MethodDelete:
+			m.Set(false)
+		default:
+			writer.Header().Set("Allow", "GET, POST, DELETE")
+			writeError(writer, errors.MethodNotAllowed(packageID, "maintenance requires GET, POST or DELETE"))
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(map[string]bool{"maintenance": m.Enabled()})
+	})
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the prometheus collectors of the gateway
+type Metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	upstream *prometheus.HistogramVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "micro_api",
+			Name:      "requests_total",
+			Help:      "Total number of requests by method, service and status code.",
+		}, []string{"method", "service", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "micro_api",
+			Name:      "request_duration_seconds",
+			Help:      "Request latency by method and service.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "service"}),
+		upstream: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "micro_api",
+			Name:      "upstream_duration_seconds",
+			Help:      "Latency of the calls to services by service, excluding the gateway middleware.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"service"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.latency,
+		m.upstream,
+	)
+	return m
+}
+
+// Gauge registers a gauge reporting the value of fn
+func (m *Metrics) Gauge(name, help string, fn func() float64) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "micro_api",
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
+
+// Handler serves the metrics in the prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// MetricsMiddleware records the count and latency of requests labeled by the resolved service
+func (m *Metrics) MetricsMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		rw := newResponseWriter(writer)
+		handler.ServeHTTP(rw, request)
+		service := serviceName(request)
+		m.requests.WithLabelValues(request.Method, service, strconv.Itoa(rw.status)).Inc()
+		m.latency.WithLabelValues(request.Method, service).Observe(time.Since(start).Seconds())
+	})
+}
+
+// UpstreamMiddleware records the time spent in the handler calling the resolved service.
+// It wraps the handler directly so each retry is observed on its own.
+func (m *Metrics) UpstreamMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		handler.ServeHTTP(writer, request)
+		m.upstream.WithLabelValues(serviceName(request)).Observe(time.Since(start).Seconds())
+	})
+}
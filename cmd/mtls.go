@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// loadCertPool reads the pem encoded certificates of a CA bundle
+func loadCertPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in %v", path)
+	}
+	return pool, nil
+}
+
+// ClientSubjectMiddleware sets the header to the subject of the verified client certificate
+// for services to authorize on. A header sent by the client is always removed.
+func ClientSubjectMiddleware(header string) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			request.Header.Del(header)
+			if request.TLS != nil && len(request.TLS.VerifiedChains) > 0 {
+				request.Header.Set(header, request.TLS.VerifiedChains[0][0].Subject.String())
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
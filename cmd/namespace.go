@@ -0,0 +1,14 @@
+package cmd
+
+import "net/http"
+
+// HeaderNamespace returns a resolver namespace read from the request header,
+// falling back to the static namespace when the header is absent
+func HeaderNamespace(header, fallback string) func(*http.Request) string {
+	return func(request *http.Request) string {
+		if ns := request.Header.Get(header); len(ns) > 0 {
+			return ns
+		}
+		return fallback
+	}
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"net/http"
+	"strings"
+
+	"go-micro.dev/v4/api/router"
+)
+
+// methods tried to tell a path served under other methods from an unknown path
+var routeMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// NotFoundHandler serves requests matching a service with the handler and requests no
+// service matches with notFound. When methodNotAllowed is set, requests for a path
+// only served under other methods are passed to it with the Allow header set instead.
+// Either may be nil to keep the default error of the handler.
+func NotFoundHandler(rtr router.Router, handler, notFound, methodNotAllowed http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if _, ok := RouteFromContext(request.Context()); ok {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		if _, err := rtr.Route(request); err == nil || !isNotFound(err) {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		if methodNotAllowed != nil {
+			if allow := allowedMethods(rtr, request); len(allow) > 0 {
+				writer.Header().Set("Allow", strings.Join(allow, ", "))
+				methodNotAllowed.ServeHTTP(writer, request)
+				return
+			}
+		}
+		if notFound != nil {
+			notFound.ServeHTTP(writer, request)
+			return
+		}
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// allowedMethods returns the other methods the request path is routed for
+func allowedMethods(rtr router.Router, request *http.Request) []string {
+	var allow []string
+	for _, method := range routeMethods {
+		if method == request.Method {
+			continue
+		}
+		r := request.Clone(request.Context())
+		r.Method = method
+		if _, err := rtr.Route(r); err == nil {
+			allow = append(allow, method)
+		}
+	}
+	return allow
+}
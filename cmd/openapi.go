@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-micro.dev/v4/errors"
+	log "go-micro.dev/v4/logger"
+	"go-micro.dev/v4/registry"
+)
+
+// services whose documents are fetched at once while merging
+const openAPIFetchConcurrency = 8
+
+// openAPI merges the OpenAPI documents served by each service into a single document
+// with the paths as routed by the gateway. The merged document is cached for the refresh
+// interval and served while it's merged again, services without a document are left out.
+type openAPI struct {
+	registry registry.Registry
+	client   *http.Client
+	// served by each service node, e.g. /openapi.json
+	specPath string
+	// namespace stripped from the service names and the base path of the gateway
+	namespace string
+	basePath  string
+	// whether the service name is the first path segment, as with the path resolvers
+	prefix  bool
+	refresh time.Duration
+	info    map[string]interface{}
+	logger  log.Logger
+
+	mtx     sync.Mutex
+	spec    []byte
+	updated time.Time
+	// error of the last merge
+	err error
+	// closed when the merge in progress completes, nil while idle
+	merging chan struct{}
+}
+
+func (o *openAPI) Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		spec, err := o.get()
+		if err != nil {
+			writeError(writer, errors.InternalServerError(packageID, "unable to merge openapi documents: %v", err))
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(spec)
+	})
+}
+
+// get returns the merged document. Once the cached one is stale it's merged again in
+// the background while the stale one is served, only the first callers wait for it.
+func (o *openAPI) get() ([]byte, error) {
+	o.mtx.Lock()
+	if o.spec != nil && time.Since(o.updated) < o.refresh {
+		defer o.mtx.Unlock()
+		return o.spec, nil
+	}
+	done := o.merging
+	if done == nil {
+		done = make(chan struct{})
+		o.merging = done
+		go o.update(done)
+	}
+	if spec := o.spec; spec != nil {
+		o.mtx.Unlock()
+		return spec, nil
+	}
+	o.mtx.Unlock()
+
+	<-done
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if o.spec == nil {
+		return nil, o.err
+	}
+	return o.spec, nil
+}
+
+// update merges the documents outside the lock, keeping the last good document on failure
+func (o *openAPI) update(done chan struct{}) {
+	spec, err := o.merge()
+
+	o.mtx.Lock()
+	if err != nil {
+		o.logger.Logf(log.WarnLevel, "Unable to merge openapi documents: %v", err)
+	} else {
+		o.spec, o.updated = spec, time.Now()
+	}
+	o.err = err
+	o.merging = nil
+	o.mtx.Unlock()
+	close(done)
+}
+
+func (o *openAPI) merge() ([]byte, error) {
+	services, err := o.registry.ListServices()
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch the documents concurrently, a dead node only delays its own service
+	type document struct {
+		service, name string
+		spec          map[string]interface{}
+	}
+	var docs []*document
+	seen := make(map[string]bool)
+	for _, s := range services {
+		name, ok := o.routed(s.Name)
+		if !ok || seen[s.Name] {
+			continue
+		}
+		seen[s.Name] = true
+		docs = append(docs, &document{service: s.Name, name: name})
+	}
+	sem := make(chan struct{}, openAPIFetchConcurrency)
+	var wg sync.WaitGroup
+	for _, doc := range docs {
+		wg.Add(1)
+		go func(doc *document) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			spec, err := o.fetch(doc.service)
+			if err != nil {
+				o.logger.Logf(log.DebugLevel, "No openapi document for %v: %v", doc.service, err)
+				return
+			}
+			doc.spec = spec
+		}(doc)
+	}
+	wg.Wait()
+
+	paths := make(map[string]interface{})
+	components := make(map[string]map[string]interface{})
+	for _, doc := range docs {
+		name, spec := doc.name, doc.spec
+		if spec == nil {
+			continue
+		}
+
+		prefix := o.basePath
+		if o.prefix {
+			prefix += "/" + strings.ReplaceAll(name, ".", "/")
+		}
+		// components are prefixed with the service so services don't clash
+		if p, ok := spec["paths"].(map[string]interface{}); ok {
+			for path, item := range p {
+				paths[prefix+path] = prefixRefs(item, name)
+			}
+		}
+		if c, ok := spec["components"].(map[string]interface{}); ok {
+			for section, entries := range c {
+				e, ok := entries.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if components[section] == nil {
+					components[section] = make(map[string]interface{})
+				}
+				for key, value := range e {
+					components[section][name+"."+key] = prefixRefs(value, name)
+				}
+			}
+		}
+	}
+	return json.Marshal(map[string]interface{}{
+		"openapi":    "3.0.3",
+		"info":       o.info,
+		"paths":      paths,
+		"components": components,
+	})
+}
+
+// routed returns the name of the service within the namespace
+func (o *openAPI) routed(service string) (string, bool) {
+	if len(o.namespace) == 0 {
+		return service, true
+	}
+	name := strings.TrimPrefix(service, o.namespace+".")
+	return name, name != service
+}
+
+// fetch gets the document of the first service node which serves one
+func (o *openAPI) fetch(service string) (map[string]interface{}, error) {
+	versions, err := o.registry.GetService(service)
+	if err != nil {
+		return nil, err
+	}
+	err = fmt.Errorf("service has no nodes")
+	for _, v := range versions {
+		for _, node := range v.Nodes {
+			var spec map[string]interface{}
+			if spec, err = o.fetchNode(node.Address); err == nil {
+				return spec, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+func (o *openAPI) fetchNode(address string) (map[string]interface{}, error) {
+	rsp, err := o.client.Get("http://" + address + o.specPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %s", address, rsp.Status)
+	}
+	var spec map[string]interface{}
+	if err := json.NewDecoder(rsp.Body).Decode(&spec); err != nil {
+		return nil, fmt.Errorf("invalid document from %s: %v", address, err)
+	}
+	return spec, nil
+}
+
+// prefixRefs rewrites the local component references within v to the prefixed components
+func prefixRefs(v interface{}, name string) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, e := range value {
+			if ref, ok := e.(string); ok && k == "$ref" && strings.HasPrefix(ref, "#/components/") {
+				// #/components/schemas/User becomes #/components/schemas/greeter.User
+				if i := strings.LastIndex(ref, "/"); i > len("#/components") {
+					value[k] = ref[:i+1] + name + "." + ref[i+1:]
+				}
+				continue
+			}
+			value[k] = prefixRefs(e, name)
+		}
+	case []interface{}:
+		for i, e := range value {
+			value[i] = prefixRefs(e, name)
+		}
+	}
+	return v
+}
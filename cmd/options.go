@@ -1,21 +1,231 @@
 package cmd
 
 import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
 	"go-micro.dev/v4/api/handler"
 	"go-micro.dev/v4/api/resolver"
 	"go-micro.dev/v4/api/router"
 	"go-micro.dev/v4/api/server"
+	"go-micro.dev/v4/registry"
 )
 
+// HandlerRoute mounts a named handler on a path prefix
+type HandlerRoute struct {
+	Prefix  string
+	Handler string
+}
+
 type Options struct {
 	// For the Command Line itself
 	Name        string
 	Description string
 	Version     string
+	// Build information, usually set with -ldflags
+	Commit    string
+	BuildDate string
+	// Flags parsed instead of os.Args, without the program name
+	Args []string
+
+	// Address the server is configured to listen on, once started
+	// the bound address, e.g. for ":0", is reported by Server.Address()
+	Address string
+	Server  *server.Server
+	// TLS config the server is serving with, nil for plain http
+	TLSConfig *tls.Config
+	// Creates the server, defaults to a net/http based server
+	ServerFactory func(address string) server.Server
+	// Time allowed to drain in-flight requests on shutdown
+	ShutdownTimeout time.Duration
+	// Time to keep serving with readiness failing before draining
+	ShutdownDelay time.Duration
+
+	// Skip the cors middleware
+	CorsDisabled bool
+	// Middleware wrapped around the handler in order
+	Middleware []func(http.Handler) http.Handler
+
+	// Serves requests no service matches, unless --fallback_url is set
+	NotFoundHandler http.Handler
+	// Serves requests for paths only routed under other methods
+	MethodNotAllowedHandler http.Handler
 
-	Server *server.Server
+	// Handlers mounted on path prefixes in front of the default handler
+	HandlerRoutes []HandlerRoute
+
+	// Registry used by the router to discover services, defaults to the go-micro registry
+	Registry registry.Registry
 
 	Routers   map[string]func(...router.Option) router.Router
 	Resolvers map[string]func(...resolver.Option) resolver.Resolver
 	Handlers  map[string]func(...handler.Option) handler.Handler
+	// Options applied to the handler of the same name when it is selected
+	HandlerOptions map[string][]handler.Option
+	// Options applied to the resolver of the same name when it is selected
+	ResolverOptions map[string][]resolver.Option
+	// Options applied to the router of the same name when it is selected
+	RouterOptions map[string][]router.Option
+	// Registries selectable by name via --registry
+	Registries map[string]func(...registry.Option) registry.Registry
+}
+
+// WithName sets the name of the command
+func WithName(n string) Option {
+	return func(o *Options) {
+		o.Name = n
+	}
+}
+
+// WithVersion sets the version of the command
+func WithVersion(v string) Option {
+	return func(o *Options) {
+		o.Version = v
+	}
+}
+
+// WithDescription sets the description of the command
+func WithDescription(d string) Option {
+	return func(o *Options) {
+		o.Description = d
+	}
+}
+
+// WithBuildInfo sets the commit and build date reported by the version command
+func WithBuildInfo(commit, buildDate string) Option {
+	return func(o *Options) {
+		o.Commit = commit
+		o.BuildDate = buildDate
+	}
+}
+
+// WithMiddleware appends middleware wrapped around the handler, the first being the outermost
+func WithMiddleware(mw ...func(http.Handler) http.Handler) Option {
+	return func(o *Options) {
+		o.Middleware = append(o.Middleware, mw...)
+	}
+}
+
+// WithRouter registers a router selectable by name via --router
+func WithRouter(name string, fn func(...router.Option) router.Router) Option {
+	return func(o *Options) {
+		routers := cloneMap(o.Routers)
+		routers[name] = fn
+		o.Routers = routers
+	}
+}
+
+// WithResolver registers a resolver selectable by name via --resolver
+func WithResolver(name string, fn func(...resolver.Option) resolver.Resolver) Option {
+	return func(o *Options) {
+		resolvers := cloneMap(o.Resolvers)
+		resolvers[name] = fn
+		o.Resolvers = resolvers
+	}
+}
+
+// WithHandler registers a handler selectable by name via --handler
+func WithHandler(name string, fn func(...handler.Option) handler.Handler) Option {
+	return func(o *Options) {
+		handlers := cloneMap(o.Handlers)
+		handlers[name] = fn
+		o.Handlers = handlers
+	}
+}
+
+// WithServerFactory sets the function used to create the server listening on the address
+func WithServerFactory(fn func(address string) server.Server) Option {
+	return func(o *Options) {
+		o.ServerFactory = fn
+	}
+}
+
+// WithHandlerRoute serves requests under the path prefix with the named handler
+// instead of the default --handler, e.g. WithHandlerRoute("/web/", "http")
+func WithHandlerRoute(prefix string, handlerName string) Option {
+	return func(o *Options) {
+		o.HandlerRoutes = append(o.HandlerRoutes, HandlerRoute{Prefix: prefix, Handler: handlerName})
+	}
+}
+
+// WithRegistry sets the registry the router discovers services in,
+// e.g. an etcd registry configured with TLS
+func WithRegistry(reg registry.Registry) Option {
+	return func(o *Options) {
+		o.Registry = reg
+	}
+}
+
+// WithRegistryFactory registers a registry selectable by name via --registry,
+// e.g. WithRegistryFactory("etcd", etcd.NewRegistry) with the go-micro etcd plugin
+func WithRegistryFactory(name string, fn func(...registry.Option) registry.Registry) Option {
+	return func(o *Options) {
+		registries := cloneMap(o.Registries)
+		registries[name] = fn
+		o.Registries = registries
+	}
+}
+
+// WithHandlerOptions sets options applied to the named handler when it is selected,
+// by --handler or a handler route, e.g. WithHandlerOptions("http", handler.WithNamespace("go.micro.web"))
+func WithHandlerOptions(name string, opts ...handler.Option) Option {
+	return func(o *Options) {
+		handlerOpts := cloneMap(o.HandlerOptions)
+		handlerOpts[name] = append(append([]handler.Option{}, handlerOpts[name]...), opts...)
+		o.HandlerOptions = handlerOpts
+	}
+}
+
+// WithResolverOptions sets options applied to the named resolver when it is selected
+// by --resolver, after the namespace and handler set from the flags
+func WithResolverOptions(name string, opts ...resolver.Option) Option {
+	return func(o *Options) {
+		resolverOpts := cloneMap(o.ResolverOptions)
+		resolverOpts[name] = append(append([]resolver.Option{}, resolverOpts[name]...), opts...)
+		o.ResolverOptions = resolverOpts
+	}
+}
+
+// WithRouterOptions sets options applied to the named router when it is selected
+// by --router, e.g. WithRouterOptions("static", router.WithLogger(l))
+func WithRouterOptions(name string, opts ...router.Option) Option {
+	return func(o *Options) {
+		routerOpts := cloneMap(o.RouterOptions)
+		routerOpts[name] = append(append([]router.Option{}, routerOpts[name]...), opts...)
+		o.RouterOptions = routerOpts
+	}
+}
+
+// WithArgs sets the flags to parse instead of os.Args, e.g. when embedding or testing
+func WithArgs(args ...string) Option {
+	return func(o *Options) {
+		o.Args = args
+	}
+}
+
+// WithNotFoundHandler serves requests no service matches with the handler instead of
+// the error of the api handler, e.g. a branded json 404. --fallback_url takes precedence.
+func WithNotFoundHandler(h http.Handler) Option {
+	return func(o *Options) {
+		o.NotFoundHandler = h
+	}
+}
+
+// WithMethodNotAllowedHandler serves requests for a path routed only under other
+// methods with the handler, the Allow header listing those methods
+func WithMethodNotAllowedHandler(h http.Handler) Option {
+	return func(o *Options) {
+		o.MethodNotAllowedHandler = h
+	}
+}
+
+// cloneMap copies m so options never mutate maps shared with the defaults or other
+// gateways, which would leak a registration or option into every gateway
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m)+1)
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
 }
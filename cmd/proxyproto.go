@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// time allowed for a client to send the PROXY protocol header
+const proxyHeaderTimeout = 10 * time.Second
+
+var proxySignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errProxyHeader = errors.New("missing or invalid PROXY protocol header")
+
+// proxyListener reads the PROXY protocol v1 or v2 header sent by load balancers
+// such as haproxy or an aws nlb, reporting the client it names as the remote address.
+// Connections without a header fail, as the listener must only be reached through the proxy.
+type proxyListener struct {
+	net.Listener
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn reads the header on first use rather than in Accept so
+// a slow client doesn't hold up accepting other connections
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+
+	mtx sync.Mutex
+	// read deadline set by the server, e.g. for the read timeout or the TLS
+	// handshake, restored once the header is read
+	deadline time.Time
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.mtx.Lock()
+		if timeout := time.Now().Add(proxyHeaderTimeout); c.deadline.IsZero() || timeout.Before(c.deadline) {
+			c.Conn.SetReadDeadline(timeout)
+		}
+		c.mtx.Unlock()
+		c.remote, c.err = readProxyHeader(c.reader)
+		c.mtx.Lock()
+		c.Conn.SetReadDeadline(c.deadline)
+		c.mtx.Unlock()
+	})
+}
+
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.deadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.deadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the client named by the header, or the peer when
+// the header names none, e.g. for health checks of the load balancer
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote == nil {
+		return c.Conn.RemoteAddr()
+	}
+	return c.remote
+}
+
+// readProxyHeader reads a v1 or v2 header, returning a nil address when it names no client
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	b, err := r.Peek(len(proxySignature))
+	if err == nil && bytes.Equal(b, proxySignature) {
+		return readProxyHeaderV2(r)
+	}
+	if b, err := r.Peek(6); err == nil && string(b) == "PROXY " {
+		return readProxyHeaderV1(r)
+	}
+	return nil, errProxyHeader
+}
+
+// readProxyHeaderV1 reads the text header, e.g. "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, error) {
+	// the header is at most 107 bytes
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == 107 {
+			return nil, errProxyHeader
+		}
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errProxyHeader
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, errProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyHeaderV2 reads the binary header
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", header[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	// a LOCAL command is sent by the proxy itself, e.g. for health checks
+	if header[12]&0x0f == 0 {
+		return nil, nil
+	}
+	switch header[13] >> 4 {
+	case 1:
+		if len(body) < 12 {
+			return nil, errProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 2:
+		if len(body) < 36 {
+			return nil, errProxyHeader
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	}
+	// unix sockets and unspecified families name no client
+	return nil, nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// proxyHeaderV2 builds a binary header with the command, family and address block
+func proxyHeaderV2(command, family byte, addresses []byte) string {
+	header := append([]byte{}, proxySignature...)
+	header = append(header, 0x20|command, family<<4|1, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(addresses)))
+	return string(append(header, addresses...))
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	ipv4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x01, 0xbb}
+	ipv6 := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0xdc, 0x04, 0x01, 0xbb)
+
+	tests := []struct {
+		name   string
+		header string
+		remote string
+		err    bool
+	}{
+		{name: "v1 tcp4", header: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", remote: "192.0.2.1:56324"},
+		{name: "v1 tcp6", header: "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", remote: "[2001:db8::1]:56324"},
+		{name: "v1 unknown", header: "PROXY UNKNOWN\r\n"},
+		{name: "v1 invalid port", header: "PROXY TCP4 192.0.2.1 198.51.100.1 65536 443\r\n", err: true},
+		{name: "v1 too long", header: "PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n", err: true},
+		{name: "v2 tcp4", header: proxyHeaderV2(1, 1, ipv4), remote: "192.0.2.1:56324"},
+		{name: "v2 tcp6", header: proxyHeaderV2(1, 2, ipv6), remote: "[2001:db8::1]:56324"},
+		{name: "v2 local", header: proxyHeaderV2(0, 0, nil)},
+		{name: "v2 short address block", header: proxyHeaderV2(1, 1, ipv4[:8]), err: true},
+		{name: "missing header", header: "GET / HTTP/1.1\r\n\r\n", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.header + "GET / HTTP/1.1\r\n\r\n"))
+			remote, err := readProxyHeader(r)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", remote)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.remote) == 0 {
+				if remote != nil {
+					t.Fatalf("expected no client, got %v", remote)
+				}
+			} else if remote == nil || remote.String() != tt.remote {
+				t.Fatalf("client %v, expected %v", remote, tt.remote)
+			}
+			// the request following the header is left to be read
+			if line, _ := r.ReadString('\n'); line != "GET / HTTP/1.1\r\n" {
+				t.Fatalf("header not consumed, read %q", line)
+			}
+		})
+	}
+}
+
+func TestProxyConnDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := &proxyConn{Conn: server, reader: bufio.NewReader(server)}
+	defer conn.Close()
+
+	// the read timeout set by the server applies once the header is read
+	go client.Write([]byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"))
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("expected the read deadline to be exceeded, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("read deadline cleared after the header")
+	}
+	if got := conn.RemoteAddr().String(); got != "192.0.2.1:56324" {
+		t.Fatalf("remote address %v", got)
+	}
+}
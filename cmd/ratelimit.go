@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-micro.dev/v4/errors"
+	"golang.org/x/time/rate"
+)
+
+// clients idle for longer than this are forgotten
+const rateLimitIdleTimeout = 3 * time.Minute
+
+// RateLimitMiddleware limits each client ip to rps requests per second with the given burst,
+// answering excess requests with a 429 and a Retry-After header. The client ip is taken
+// from X-Forwarded-For only for requests from trusted proxies.
+func RateLimitMiddleware(rps float64, burst int, trusted []net.IPNet) func(http.Handler) http.Handler {
+	limiter := newClientLimiter(rate.Limit(rps), burst)
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if ok, retry := limiter.allow(ClientIP(request, trusted)); !ok {
+				writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+				writeError(writer, errors.New(packageID, "rate limit exceeded", http.StatusTooManyRequests))
+				return
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+type clientLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mtx     sync.Mutex
+	clients map[string]*client
+	swept   time.Time
+}
+
+type client struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+func newClientLimiter(limit rate.Limit, burst int) *clientLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &clientLimiter{
+		limit:   limit,
+		burst:   burst,
+		clients: make(map[string]*client),
+		swept:   time.Now(),
+	}
+}
+
+// allow reports whether the client may proceed, or how long it should wait
+func (l *clientLimiter) allow(ip string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mtx.Lock()
+	if now.Sub(l.swept) > rateLimitIdleTimeout {
+		for k, c := range l.clients {
+			if now.Sub(c.seen) > rateLimitIdleTimeout {
+				delete(l.clients, k)
+			}
+		}
+		l.swept = now
+	}
+	c, ok := l.clients[ip]
+	if !ok {
+		c = &client{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = c
+	}
+	c.seen = now
+	l.mtx.Unlock()
+
+	r := c.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"go-micro.dev/v4/errors"
+	log "go-micro.dev/v4/logger"
+)
+
+// RecoverMiddleware recovers panics in the handler chain, logging the stack and returning a 500
+func RecoverMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			if r := recover(); r != nil {
+				// let net/http abort the response as intended
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				requestLogger(request.Context()).Logf(log.ErrorLevel, "panic serving %s %s: %v\n%s", request.Method, request.URL.Path, r, debug.Stack())
+				writeError(writer, errors.InternalServerError(packageID, "internal server error"))
+			}
+		}()
+		handler.ServeHTTP(writer, request)
+	})
+}
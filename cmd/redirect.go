@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HTTPSRedirectMiddleware redirects plain http requests to https on the default port. Requests
+// with "X-Forwarded-Proto: https" were received over tls by a proxy and are served, so
+// terminating tls at a load balancer doesn't cause a redirect loop.
+func HTTPSRedirectMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.TLS != nil || strings.EqualFold(forwardedProto(request), "https") {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+		host := request.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+			if strings.Contains(host, ":") {
+				host = "[" + host + "]"
+			}
+		}
+		// a 308 keeps the method and body of requests other than GET and HEAD
+		code := http.StatusPermanentRedirect
+		if request.Method == http.MethodGet || request.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(writer, request, "https://"+host+request.URL.RequestURI(), code)
+	})
+}
+
+// forwardedProto returns the protocol the first proxy received the request with
+func forwardedProto(request *http.Request) string {
+	proto := request.Header.Get("X-Forwarded-Proto")
+	if i := strings.Index(proto, ","); i >= 0 {
+		proto = proto[:i]
+	}
+	return strings.TrimSpace(proto)
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/urfave/cli/v2"
+	log "go-micro.dev/v4/logger"
+)
+
+// settings reloaded on SIGHUP without restarting the listener
+var reloadable = map[string]bool{
+	"log_level":            true,
+	"cors_allowed_origins": true,
+	"cors_allowed_methods": true,
+	"cors_allowed_headers": true,
+	"cors_max_age":         true,
+	"rate_limit":           true,
+	"rate_limit_burst":     true,
+}
+
+// reloader re-reads the config file and swaps the middleware built from it
+type reloader struct {
+	path string
+	// flags set on the command line or environment, which take precedence over the file
+	explicit map[string]bool
+	config   Config
+
+	cors       *swappable
+	corsConfig CorsConfig
+	grpcWeb    bool // adds the grpc-web headers to the allowed cors headers
+	rateLimit  *swappable
+	rps        float64
+	burst      int
+	trusted    []net.IPNet
+	logger     log.Logger
+}
+
+func newReloader(ctx *cli.Context, path string, config Config) *reloader {
+	explicit := make(map[string]bool)
+	for _, flag := range ctx.App.Flags {
+		if name := flag.Names()[0]; ctx.IsSet(name) {
+			explicit[name] = true
+		}
+	}
+	return &reloader{path: path, explicit: explicit, config: config}
+}
+
+// reload applies the changes in the config file which can be hot swapped and
+// logs those which require a restart
+func (r *reloader) reload() error {
+	config, err := LoadConfig(r.path)
+	if err != nil {
+		return err
+	}
+	before, after := r.config.fields(), config.fields()
+
+	var changed []string
+	for name := range reloadable {
+		if !r.explicit[name] && !reflect.DeepEqual(before[name], after[name]) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range after {
+		if !r.explicit[name] && !reloadable[name] && !reflect.DeepEqual(before[name], after[name]) {
+			r.logger.Logf(log.WarnLevel, "Config %v changed, restart required to apply it", name)
+		}
+	}
+
+	// the changes are validated before any is applied so an invalid file changes nothing
+	var level *log.Level
+	var corsChanged, rateChanged bool
+	corsConfig, rps, burst := r.corsConfig, r.rps, r.burst
+	for _, name := range changed {
+		switch name {
+		case "log_level":
+			arg := valueOr(config.LogLevel, name)
+			l, err := log.GetLevel(arg)
+			if err != nil {
+				return fmt.Errorf("invalid log level %v", arg)
+			}
+			level = &l
+		case "cors_allowed_origins":
+			corsConfig.AllowedOrigins = listOr(config.CorsAllowedOrigins, name, DefaultCorsConfig.AllowedOrigins)
+			corsChanged = true
+		case "cors_allowed_methods":
+			corsConfig.AllowedMethods = listOr(config.CorsAllowedMethods, name, DefaultCorsConfig.AllowedMethods)
+			corsChanged = true
+		case "cors_allowed_headers":
+			corsConfig.AllowedHeaders = listOr(config.CorsAllowedHeaders, name, DefaultCorsConfig.AllowedHeaders)
+			if r.grpcWeb {
+				corsConfig.AllowedHeaders = grpcWebAllowedHeaders(corsConfig.AllowedHeaders)
+			}
+			corsChanged = true
+		case "cors_max_age":
+			corsConfig.MaxAge = valueOr(config.CorsMaxAge, name)
+			corsChanged = true
+		case "rate_limit":
+			rps = valueOr(config.RateLimit, name)
+			rateChanged = true
+		case "rate_limit_burst":
+			burst = valueOr(config.RateLimitBurst, name)
+			rateChanged = true
+		}
+	}
+	if corsChanged && r.cors != nil {
+		if err := corsConfig.validate(); err != nil {
+			return fmt.Errorf("invalid cors settings: %v", err)
+		}
+	}
+
+	if level != nil {
+		if err := r.logger.Init(log.WithLevel(*level)); err != nil {
+			return err
+		}
+	}
+	if corsChanged && r.cors != nil {
+		r.corsConfig = corsConfig
+		r.cors.swap(func(h http.Handler) http.Handler {
+			return CorsMiddlewareWithConfig(corsConfig, h)
+		})
+	}
+	r.rps, r.burst = rps, burst
+	if rateChanged && r.rateLimit != nil {
+		r.rateLimit.swap(rateLimit(rps, burst, r.trusted))
+	}
+
+	r.config = config
+	logEvent(r.logger, "Config reloaded", map[string]interface{}{"path": r.path, "changed": strings.Join(changed, ",")})
+	return nil
+}
+
+// rateLimit returns the rate limit middleware, passing requests through when disabled
+func rateLimit(rps float64, burst int, trusted []net.IPNet) func(http.Handler) http.Handler {
+	if rps <= 0 {
+		return func(h http.Handler) http.Handler { return h }
+	}
+	return RateLimitMiddleware(rps, burst, trusted)
+}
+
+// valueOr returns the value set in the config, or else the default of the flag
+// so removing a key from the file restores the default
+func valueOr[T any](value *T, name string) T {
+	if value != nil {
+		return *value
+	}
+	def, _ := flagDefault(name).(T)
+	return def
+}
+
+// listOr returns the values set in the config, or else the default of the flag,
+// falling back to defaults when both are empty
+func listOr(values []string, name string, defaults []string) []string {
+	if len(values) == 0 {
+		values, _ = flagDefault(name).([]string)
+	}
+	if values = splitList(values); len(values) == 0 {
+		return defaults
+	}
+	return values
+}
+
+// flagDefault returns the default of the named flag. It's read from DefaultFlags as
+// parsing sets the slice flags of the app to the values given on the command line.
+func flagDefault(name string) interface{} {
+	for _, flag := range DefaultFlags {
+		if flag.Names()[0] != name {
+			continue
+		}
+		switch f := flag.(type) {
+		case *cli.StringFlag:
+			return f.Value
+		case *cli.IntFlag:
+			return f.Value
+		case *cli.Float64Flag:
+			return f.Value
+		case *cli.StringSliceFlag:
+			if f.Value != nil {
+				return f.Value.Value()
+			}
+		}
+	}
+	return nil
+}
+
+// fields returns the settings present in the config keyed by flag name
+func (c Config) fields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if field := v.Field(i); !field.IsNil() {
+			fields[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = field.Interface()
+		}
+	}
+	return fields
+}
+
+// swappable is middleware which can be replaced while serving
+type swappable struct {
+	mtx      sync.Mutex
+	mw       func(http.Handler) http.Handler
+	handlers []*swapHandler
+}
+
+type swapHandler struct {
+	next    http.Handler
+	current atomic.Value
+}
+
+func newSwappable(mw func(http.Handler) http.Handler) *swappable {
+	return &swappable{mw: mw}
+}
+
+// Middleware wraps the handler in the current middleware, following later swaps
+func (s *swappable) Middleware(next http.Handler) http.Handler {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	h := &swapHandler{next: next}
+	h.current.Store(s.mw(next))
+	s.handlers = append(s.handlers, h)
+	return h
+}
+
+func (s *swappable) swap(mw func(http.Handler) http.Handler) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.mw = mw
+	for _, h := range s.handlers {
+		h.current.Store(mw(h.next))
+	}
+}
+
+func (h *swapHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.current.Load().(http.Handler).ServeHTTP(writer, request)
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	log "go-micro.dev/v4/logger"
+)
+
+func TestReloadRestoresDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`rate_limit: 5
+rate_limit_burst: 3
+cors_max_age: 60
+cors_allowed_origins: [https://app.example.com]
+`)
+
+	c := startCmd(t, "--config="+path)
+	r := c.reloader
+	if r.burst != 3 || r.corsConfig.MaxAge != 60 {
+		t.Fatalf("config not applied, burst %d max age %d", r.burst, r.corsConfig.MaxAge)
+	}
+
+	// removed keys return to the defaults of their flags
+	write("rate_limit: 5\n")
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if r.rps != 5 {
+		t.Errorf("rate_limit = %v, expected the config value 5", r.rps)
+	}
+	if r.burst != 10 {
+		t.Errorf("rate_limit_burst = %d, expected the default 10", r.burst)
+	}
+	if r.corsConfig.MaxAge != 600 {
+		t.Errorf("cors_max_age = %d, expected the default 600", r.corsConfig.MaxAge)
+	}
+	if want := []string{"*"}; !reflect.DeepEqual(r.corsConfig.AllowedOrigins, want) {
+		t.Errorf("cors_allowed_origins = %v, expected the default %v", r.corsConfig.AllowedOrigins, want)
+	}
+
+	write("")
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if r.rps != 0 {
+		t.Errorf("rate_limit = %v, expected the default 0", r.rps)
+	}
+}
+
+func TestReloadInvalidChangesNothing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("rate_limit: 5\nlog_level: info\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := startCmd(t, "--config="+path)
+	r := c.reloader
+
+	content := `rate_limit: 50
+rate_limit_burst: 30
+cors_max_age: 60
+log_level: loud
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.reload(); err == nil {
+		t.Fatal("expected the invalid log level to be rejected")
+	}
+	if r.rps != 5 || r.burst != 10 || r.corsConfig.MaxAge != 600 {
+		t.Errorf("partially applied, rate %v burst %d max age %d", r.rps, r.burst, r.corsConfig.MaxAge)
+	}
+	if got := c.logger.Options().Level; got != log.InfoLevel {
+		t.Errorf("log level %v, expected info", got)
+	}
+}
+
+func TestReloadKeepsGRPCWebHeaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("cors_allowed_headers: [Content-Type]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := startCmd(t, "--config="+path, "--grpc_web")
+	r := c.reloader
+	want := grpcWebAllowedHeaders([]string{"Content-Type"})
+	if !reflect.DeepEqual(r.corsConfig.AllowedHeaders, want) {
+		t.Fatalf("cors_allowed_headers = %v, expected %v", r.corsConfig.AllowedHeaders, want)
+	}
+
+	// the defaults are restored along with the grpc-web headers
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if want := grpcWebAllowedHeaders(DefaultCorsConfig.AllowedHeaders); !reflect.DeepEqual(r.corsConfig.AllowedHeaders, want) {
+		t.Errorf("cors_allowed_headers = %v, expected %v", r.corsConfig.AllowedHeaders, want)
+	}
+}
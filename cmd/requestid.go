@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds incoming ids so clients can't flood logs
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDMiddleware propagates the X-Request-ID header of each request, generating
+// one when absent. The id is set on the request forwarded upstream, the response and
+// the request context.
+func RequestIDMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(requestIDHeader)
+		if len(id) == 0 || len(id) > maxRequestIDLength {
+			id = uuid.New().String()
+			request.Header.Set(requestIDHeader, id)
+		}
+		writer.Header().Set(requestIDHeader, id)
+		handler.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFromContext returns the id stored by RequestIDMiddleware
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
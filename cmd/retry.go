@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	"go-micro.dev/v4/errors"
+)
+
+// RetryMiddleware retries idempotent requests, GET, HEAD and OPTIONS, answered with a
+// 502, 503 or 504 up to count times, doubling the backoff after each attempt. Other
+// methods are never retried. The request body is buffered, unless --buffer_request_body
+// did already, so it can be replayed while the response of the final attempt is
+// streamed to the client as usual.
+func RetryMiddleware(count int, backoff time.Duration) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		if count <= 0 {
+			return handler
+		}
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if !idempotent(request.Method) {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+
+			if err := bufferBody(request, 0); err != nil {
+				writeError(writer, err)
+				return
+			}
+
+			delay := backoff
+			for attempt := 0; ; attempt++ {
+				rewindBody(request)
+				rw := &retryWriter{w: writer, h: make(http.Header), retry: attempt < count}
+				handler.ServeHTTP(rw, request)
+				if !rw.discarded {
+					return
+				}
+
+				select {
+				case <-request.Context().Done():
+					writeError(writer, errors.New(packageID, "request cancelled while retrying", http.StatusServiceUnavailable))
+					return
+				case <-time.After(delay):
+				}
+				delay *= 2
+			}
+		})
+	}
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func retryable(code int) bool {
+	switch code {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryWriter holds back the headers until the status is known, discarding the
+// response of an attempt that will be retried and passing any other through
+type retryWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	// whether a retryable response may be discarded
+	retry       bool
+	discarded   bool
+	wroteHeader bool
+}
+
+func (rw *retryWriter) Header() http.Header {
+	return rw.h
+}
+
+func (rw *retryWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
+	if rw.retry && retryable(code) {
+		rw.discarded = true
+		return
+	}
+	dst := rw.w.Header()
+	for k, v := range rw.h {
+		dst[k] = v
+	}
+	rw.w.WriteHeader(code)
+}
+
+func (rw *retryWriter) Write(b []byte) (int, error) {
+	rw.WriteHeader(http.StatusOK)
+	if rw.discarded {
+		return len(b), nil
+	}
+	return rw.w.Write(b)
+}
+
+func (rw *retryWriter) Flush() {
+	rw.WriteHeader(http.StatusOK)
+	if rw.discarded {
+		return
+	}
+	flush(rw.w)
+}
+
+func (rw *retryWriter) Unwrap() http.ResponseWriter {
+	return rw.w
+}
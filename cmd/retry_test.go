@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyBackend fails the first failures requests with a 503 and serves the others
+func flakyBackend(failures int, hits *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+		body, _ := io.ReadAll(r.Body)
+		if *hits <= failures {
+			w.Header().Set("X-Attempt", "failed")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "unavailable")
+			return
+		}
+		io.WriteString(w, "ok "+string(body))
+	})
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		failures int
+		hits     int
+		status   int
+		body     string
+	}{
+		{name: "GET is retried", method: http.MethodGet, failures: 1, hits: 2, status: http.StatusOK, body: "ok payload"},
+		{name: "POST is never retried", method: http.MethodPost, failures: 1, hits: 1, status: http.StatusServiceUnavailable, body: "unavailable"},
+		{name: "last attempt is passed through", method: http.MethodGet, failures: 10, hits: 3, status: http.StatusServiceUnavailable, body: "unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits int
+			h := RetryMiddleware(2, time.Millisecond)(flakyBackend(tt.failures, &hits))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tt.method, "/greeter", strings.NewReader("payload")))
+
+			if hits != tt.hits {
+				t.Errorf("backend hit %d times, expected %d", hits, tt.hits)
+			}
+			if w.Code != tt.status {
+				t.Errorf("status %d, expected %d", w.Code, tt.status)
+			}
+			if got := w.Body.String(); got != tt.body {
+				t.Errorf("body %q, expected %q", got, tt.body)
+			}
+			if tt.status != http.StatusOK && w.Header().Get("X-Attempt") != "failed" {
+				t.Errorf("headers of the backend response not passed through: %v", w.Header())
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const originalPathHeader = "X-Original-Path"
+
+type originalPathKey struct{}
+
+// RewriteRule rewrites request paths matching a prefix, or a regular expression when it starts with ^
+type RewriteRule struct {
+	from string
+	to   string
+	re   *regexp.Regexp
+}
+
+// NewRewriteRule returns a rule rewriting the from prefix to the replacement, e.g. /v1/ to /,
+// or a ^regex to the replacement which may refer to submatches as $1
+func NewRewriteRule(from, to string) (RewriteRule, error) {
+	rule := RewriteRule{from: from, to: to}
+	if len(from) == 0 {
+		return rule, fmt.Errorf("empty rewrite rule for %q", to)
+	}
+	if strings.HasPrefix(from, "^") {
+		re, err := regexp.Compile(from)
+		if err != nil {
+			return rule, fmt.Errorf("invalid rewrite rule %q: %v", from, err)
+		}
+		rule.re = re
+	}
+	return rule, nil
+}
+
+// rewrite returns the rewritten path and whether the rule matched
+func (r RewriteRule) rewrite(path string) (string, bool) {
+	if r.re != nil {
+		if !r.re.MatchString(path) {
+			return path, false
+		}
+		return r.re.ReplaceAllString(path, r.to), true
+	}
+	if !strings.HasPrefix(path, r.from) {
+		return path, false
+	}
+	return r.to + strings.TrimPrefix(path, r.from), true
+}
+
+// RewriteMiddleware rewrites the request path with the first matching rule, rules being tried
+// in order. The original path is passed on in the X-Original-Path header.
+func RewriteMiddleware(rules []RewriteRule) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			// never trust a client supplied original path
+			request.Header.Del(originalPathHeader)
+			original := request.URL.Path
+			for _, rule := range rules {
+				path, ok := rule.rewrite(original)
+				if !ok {
+					continue
+				}
+				if !strings.HasPrefix(path, "/") {
+					path = "/" + path
+				}
+				u := *request.URL
+				u.Path, u.RawPath = path, ""
+				request = request.WithContext(context.WithValue(request.Context(), originalPathKey{}, original))
+				request.URL = &u
+				request.Header.Set(originalPathHeader, original)
+				break
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// originalPath returns the path of the request before it was rewritten
+func originalPath(request *http.Request) string {
+	if path, ok := request.Context().Value(originalPathKey{}).(string); ok {
+		return path
+	}
+	return request.URL.Path
+}
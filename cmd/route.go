@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+
+	"go-micro.dev/v4/api/router"
+)
+
+type routeKey struct{}
+
+// RouteMiddleware resolves the route of each request up front and stores it in the
+// request context so middleware can act on the target service. Routing errors are
+// left for the handler to report.
+func RouteMiddleware(rtr router.Router) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if route, err := rtr.Route(request); err == nil {
+				request = request.WithContext(context.WithValue(request.Context(), routeKey{}, route))
+			}
+			handler.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// RouteFromContext returns the route resolved by RouteMiddleware
+func RouteFromContext(ctx context.Context) (*router.Route, bool) {
+	route, ok := ctx.Value(routeKey{}).(*router.Route)
+	return route, ok
+}
+
+// serviceName returns the resolved service of the request or "unknown"
+func serviceName(request *http.Request) string {
+	if route, ok := RouteFromContext(request.Context()); ok && len(route.Service) > 0 {
+		return route.Service
+	}
+	return "unknown"
+}
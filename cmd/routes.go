@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-micro.dev/v4/api/router"
+	"gopkg.in/yaml.v3"
+)
+
+// RouteConfig maps http requests to a service endpoint for the static router
+type RouteConfig struct {
+	// Service name, which may not contain dots as the static router splits on them
+	Service string `json:"service" yaml:"service"`
+	// RPC endpoint e.g. Greeter.Hello
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// HTTP methods e.g. GET, POST
+	Method []string `json:"method" yaml:"method"`
+	// HTTP paths e.g. /greeter/{name} or a ^regex$
+	Path []string `json:"path" yaml:"path"`
+	// HTTP hosts, any host when empty
+	Host        []string `json:"host,omitempty" yaml:"host,omitempty"`
+	Stream      bool     `json:"stream,omitempty" yaml:"stream,omitempty"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// LoadRoutes reads a json or yaml route table of the form {"routes": [RouteConfig...]}
+func LoadRoutes(path string) ([]*router.Route, error) {
+	var file struct {
+		Routes []RouteConfig `json:"routes" yaml:"routes"`
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(b, &file)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &file)
+	default:
+		return nil, fmt.Errorf("unsupported routes file %v, expected .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse routes file %v: %v", path, err)
+	}
+
+	routes := make([]*router.Route, 0, len(file.Routes))
+	for i, r := range file.Routes {
+		if len(r.Service) == 0 || strings.Contains(r.Service, ".") {
+			return nil, fmt.Errorf("route %d: service %q must be set and may not contain dots", i, r.Service)
+		}
+		if len(r.Endpoint) == 0 {
+			return nil, fmt.Errorf("route %d: endpoint is required", i)
+		}
+		if len(r.Method) == 0 || len(r.Path) == 0 {
+			return nil, fmt.Errorf("route %d: at least one method and path are required", i)
+		}
+		for _, p := range r.Path {
+			if len(p) == 0 {
+				return nil, fmt.Errorf("route %d: empty path", i)
+			}
+		}
+		endpoint := &router.Endpoint{
+			Name:        r.Service + "." + r.Endpoint,
+			Description: r.Description,
+			Handler:     "rpc",
+			Host:        r.Host,
+			Method:      r.Method,
+			Path:        r.Path,
+			Stream:      r.Stream,
+		}
+		if err := router.Validate(endpoint); err != nil {
+			return nil, fmt.Errorf("route %d: %v", i, err)
+		}
+		routes = append(routes, &router.Route{Service: r.Service, Endpoint: endpoint})
+	}
+	return routes, nil
+}
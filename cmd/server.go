@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-micro.dev/v4/api/server"
+	"go-micro.dev/v4/api/server/cors"
+	log "go-micro.dev/v4/logger"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"golang.org/x/net/netutil"
+)
+
+// serverConfig tunes the net/http server beyond the go-micro server options
+type serverConfig struct {
+	// Serve HTTP/2 without TLS alongside HTTP/1.1
+	H2C bool
+	// Maximum duration for reading a request including the body
+	ReadTimeout time.Duration
+	// Maximum duration before timing out writes of the response
+	WriteTimeout time.Duration
+	// Maximum time to wait for the next request on keep-alive connections
+	IdleTimeout time.Duration
+	// Close connections after each response with Connection: close
+	DisableKeepAlives bool
+	// Maximum number of concurrent connections, further connections wait
+	// to be accepted. 0 means unlimited.
+	MaxConnections int
+	// Counts the open connections when set
+	Connections *connCounter
+	// Read the client address from the PROXY protocol header
+	ProxyProtocol bool
+	// Receives the error when serving fails once started, so the others can be stopped
+	Errors chan<- error
+}
+
+// httpServer is the go-micro http api server backed by a net/http server
+// so in-flight requests can be drained on shutdown
+type httpServer struct {
+	mux    *http.ServeMux
+	opts   server.Options
+	config serverConfig
+
+	mtx     sync.RWMutex
+	address string
+	srv     *http.Server
+}
+
+func newServer(address string, config serverConfig, opts ...server.Option) server.Server {
+	return &httpServer{
+		opts:    server.NewOptions(opts...),
+		config:  config,
+		mux:     http.NewServeMux(),
+		address: address,
+	}
+}
+
+func (s *httpServer) Address() string {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.address
+}
+
+func (s *httpServer) Init(opts ...server.Option) error {
+	for _, o := range opts {
+		o(&s.opts)
+	}
+	return nil
+}
+
+func (s *httpServer) Handle(path string, handler http.Handler) {
+	// apply the wrappers, e.g. auth
+	for _, wrapper := range s.opts.Wrappers {
+		handler = wrapper(handler)
+	}
+
+	// wrap with cors
+	if s.opts.EnableCORS {
+		handler = cors.CombinedCORSHandler(handler, s.opts.CORSConfig)
+	}
+
+	s.mux.Handle(path, handler)
+}
+
+func (s *httpServer) Start() error {
+	logger := s.opts.Logger
+	var l net.Listener
+	var err error
+
+	network, addr := splitAddress(s.Address())
+	if network == "unix" {
+		if err := removeStaleSocket(addr); err != nil {
+			return err
+		}
+	}
+
+	acme := s.opts.EnableACME && s.opts.ACMEProvider != nil
+	if acme {
+		if s.config.ProxyProtocol || s.config.MaxConnections > 0 {
+			return errors.New("the PROXY protocol and connection limits are not supported with ACME")
+		}
+		l, err = s.opts.ACMEProvider.Listen(s.opts.ACMEHosts...)
+	} else {
+		l, err = net.Listen(network, addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	// wrap the plain connections, net/http only detects tls on unwrapped tls connections
+	if !acme {
+		// the header precedes the tls handshake
+		if s.config.ProxyProtocol {
+			l = &proxyListener{Listener: l}
+		}
+		if s.config.Connections != nil {
+			l = s.config.Connections.Listener(l)
+		}
+		if s.config.MaxConnections > 0 {
+			l = netutil.LimitListener(l, s.config.MaxConnections)
+		}
+		if s.opts.EnableTLS && s.opts.TLSConfig != nil {
+			l = tls.NewListener(l, s.opts.TLSConfig)
+		}
+	}
+
+	address := l.Addr().String()
+	if l.Addr().Network() == "unix" {
+		address = unixScheme + address
+	}
+
+	logger.Logf(log.InfoLevel, "HTTP API Listening on %s", address)
+
+	var handler http.Handler = s.mux
+	if s.config.H2C {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+
+	srv := &http.Server{
+		Handler:      handler,
+		ReadTimeout:  s.config.ReadTimeout,
+		WriteTimeout: s.config.WriteTimeout,
+		IdleTimeout:  s.config.IdleTimeout,
+	}
+	srv.SetKeepAlivesEnabled(!s.config.DisableKeepAlives)
+
+	s.mtx.Lock()
+	s.address = address
+	s.srv = srv
+	s.mtx.Unlock()
+
+	go func() {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			logger.Log(log.ErrorLevel, err)
+			select {
+			case s.config.Errors <- fmt.Errorf("unable to serve on %v: %w", address, err):
+			default:
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *httpServer) Stop() error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Close()
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// to complete or the context to be done
+func (s *httpServer) Shutdown(ctx context.Context) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *httpServer) String() string {
+	return "http"
+}
@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-micro.dev/v4/registry"
+)
+
+// startCmd starts a gateway on an ephemeral localhost port with the flags,
+// stopping it when the test completes
+func startCmd(t *testing.T, args ...string) *cmd {
+	t.Helper()
+	args = append([]string{"--server_address=127.0.0.1:0"}, args...)
+	c := newCmd(WithRegistry(registry.NewMemoryRegistry()), WithArgs(args...)).(*cmd)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Stop()
+	})
+	return c
+}
+
+// expectClosed fails unless the server closes the connection within the timeout
+func expectClosed(t *testing.T, r io.Reader, conn net.Conn, timeout time.Duration) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	if b, err := io.ReadAll(r); err != nil {
+		t.Fatalf("expected the connection to be closed, got %v after reading %q", err, b)
+	}
+}
+
+func TestServerTimeouts(t *testing.T) {
+	c := startCmd(t, "--read_timeout=200ms", "--write_timeout=3s", "--idle_timeout=4s")
+
+	srv := (*c.opts.Server).(*httpServer).srv
+	if srv.ReadTimeout != 200*time.Millisecond || srv.WriteTimeout != 3*time.Second || srv.IdleTimeout != 4*time.Second {
+		t.Fatalf("timeouts not applied, read %v write %v idle %v", srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+
+	conn, err := net.Dial("tcp", c.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// hold the request open without completing the headers
+	start := time.Now()
+	if _, err := io.WriteString(conn, "GET /health HTTP/1.1\r\nHost: localhost\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	expectClosed(t, conn, conn, 2*time.Second)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("connection closed after %v, before the read timeout", elapsed)
+	}
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		keepAlive bool
+	}{
+		{name: "enabled by default", keepAlive: true},
+		{name: "disabled", args: []string{"--keep_alive=false"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := startCmd(t, tt.args...)
+
+			conn, err := net.Dial("tcp", c.Address())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if _, err := io.WriteString(conn, "GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n"); err != nil {
+				t.Fatal(err)
+			}
+			r := bufio.NewReader(conn)
+			rsp, err := http.ReadResponse(r, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, rsp.Body)
+			rsp.Body.Close()
+			if rsp.StatusCode != http.StatusOK {
+				t.Fatalf("unexpected status %v", rsp.Status)
+			}
+
+			if !tt.keepAlive {
+				// ReadResponse consumes the Connection: close header into Close
+				if !rsp.Close {
+					t.Fatal("expected Connection: close")
+				}
+				expectClosed(t, r, conn, 2*time.Second)
+				return
+			}
+
+			if rsp.Close {
+				t.Fatal("expected the connection to be kept alive")
+			}
+			// a second request is served on the same connection
+			if _, err := io.WriteString(conn, "GET /health HTTP/1.1\r\nHost: localhost\r\n\r\n"); err != nil {
+				t.Fatal(err)
+			}
+			if rsp, err = http.ReadResponse(r, nil); err != nil {
+				t.Fatalf("connection not kept alive: %v", err)
+			}
+			rsp.Body.Close()
+		})
+	}
+}
+
+// freeAddress returns a localhost address which is free to listen on
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestServeErrorStopsListeners(t *testing.T) {
+	addresses := []string{freeAddress(t), freeAddress(t)}
+	c := newCmd(WithRegistry(registry.NewMemoryRegistry()), WithArgs("--server_address="+addresses[0]+","+addresses[1])).(*cmd)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.RunContext(context.Background())
+	}()
+	for _, address := range addresses {
+		for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+			conn, err := net.Dial("tcp", address)
+			if err == nil {
+				conn.Close()
+				break
+			}
+			if time.Since(start) > 2*time.Second {
+				t.Fatalf("%v not listening: %v", address, err)
+			}
+		}
+	}
+
+	// a listener failing while serving shuts the gateway down
+	failure := errors.New("accept failed")
+	c.serveErrors <- failure
+	select {
+	case err := <-done:
+		if err != failure {
+			t.Fatalf("expected the serve error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("gateway kept serving")
+	}
+	for _, address := range addresses {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			t.Errorf("%v still listening", address)
+		}
+	}
+}
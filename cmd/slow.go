@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	log "go-micro.dev/v4/logger"
+)
+
+// SlowRequestMiddleware logs a warning for requests taking longer than the threshold
+func SlowRequestMiddleware(threshold time.Duration) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			start := time.Now()
+			rw := newResponseWriter(writer)
+			handler.ServeHTTP(rw, request)
+			latency := time.Since(start)
+			if latency <= threshold {
+				return
+			}
+			logger := requestLogger(request.Context())
+			if id, ok := RequestIDFromContext(request.Context()); ok {
+				logger = logger.Fields(map[string]interface{}{"request_id": id})
+			}
+			logger.Logf(log.WarnLevel, "Slow request method=%s path=%s service=%s status=%d latency=%s",
+				request.Method, request.URL.Path, serviceName(request), rw.status, latency)
+		})
+	}
+}
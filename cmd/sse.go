@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"net/http"
+	"strings"
+)
+
+const eventStreamType = "text/event-stream"
+
+// isEventStream reports whether the response is a stream of server-sent events
+func isEventStream(header http.Header) bool {
+	return strings.HasPrefix(strings.ToLower(header.Get("Content-Type")), eventStreamType)
+}
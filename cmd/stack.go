@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"io"
+	"runtime"
+)
+
+// dumpStacks writes the stacks of all goroutines, growing the buffer until they fit
+func dumpStacks(w io.Writer) {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			w.Write(buf[:n])
+			return
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
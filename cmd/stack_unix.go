@@ -0,0 +1,11 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// signals dumping the goroutine stacks with --debug_signals
+var stackSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,6 @@
+package cmd
+
+import "os"
+
+// SIGUSR1 doesn't exist on windows, so --debug_signals has no effect
+var stackSignals []os.Signal
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-micro.dev/v4/errors"
+)
+
+// TimeoutMiddleware bounds the time a request may take. When the deadline passes
+// before the response starts the client receives a 504 and any later writes by the
+// handler are discarded. Responses already being written aren't replaced, but the
+// request context is still cancelled at the deadline so streams are cut off then;
+// exempt them with a timeout of 0, e.g. with RouteTimeoutMiddleware.
+func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
+	return RouteTimeoutMiddleware(timeout, nil)
+}
+
+// RouteTimeout overrides the request timeout for requests whose path starts with the
+// prefix or, when it doesn't start with a slash, for requests to the named service
+type RouteTimeout struct {
+	Prefix  string
+	Timeout time.Duration
+}
+
+// ParseRouteTimeout parses a prefix=duration override, e.g. /reports/=2m or greeter=5s
+func ParseRouteTimeout(value string) (RouteTimeout, error) {
+	i := strings.LastIndex(value, "=")
+	if i <= 0 {
+		return RouteTimeout{}, fmt.Errorf("invalid route timeout %q, expected prefix=duration", value)
+	}
+	timeout, err := time.ParseDuration(value[i+1:])
+	if err != nil || timeout < 0 {
+		return RouteTimeout{}, fmt.Errorf("invalid duration in route timeout %q", value)
+	}
+	return RouteTimeout{Prefix: value[:i], Timeout: timeout}, nil
+}
+
+func (r RouteTimeout) match(request *http.Request) bool {
+	if strings.HasPrefix(r.Prefix, "/") {
+		return strings.HasPrefix(request.URL.Path, r.Prefix)
+	}
+	service := serviceName(request)
+	return service == r.Prefix || strings.HasSuffix(service, "."+r.Prefix)
+}
+
+// RouteTimeoutMiddleware applies the timeout of the first matching route, or the
+// default timeout when none matches, as TimeoutMiddleware does. A timeout of 0
+// leaves the requests unbounded. Services are matched by the route resolved by
+// RouteMiddleware.
+func RouteTimeoutMiddleware(timeout time.Duration, routes []RouteTimeout) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		if timeout <= 0 && len(routes) == 0 {
+			return handler
+		}
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			timeout := timeout
+			for _, route := range routes {
+				if route.match(request) {
+					timeout = route.Timeout
+					break
+				}
+			}
+			if timeout <= 0 {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			ctx, cancel := context.WithTimeout(request.Context(), timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{w: writer, h: make(http.Header)}
+			done := make(chan struct{})
+			panicChan := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicChan <- p
+					}
+				}()
+				handler.ServeHTTP(tw, request.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				panic(p)
+			case <-done:
+			case <-ctx.Done():
+				tw.mu.Lock()
+				if !tw.wroteHeader {
+					tw.timedOut = true
+					tw.mu.Unlock()
+					writeError(writer, errors.New(packageID, fmt.Sprintf("request timed out after %v", timeout), http.StatusGatewayTimeout))
+					return
+				}
+				tw.mu.Unlock()
+				// the response has started so it isn't replaced, the handler
+				// returns once it notices the cancelled context
+				select {
+				case p := <-panicChan:
+					panic(p)
+				case <-done:
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter guards the response so the handler and the timeout never both write it
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu          sync.Mutex
+	timedOut    bool
+	wroteHeader bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	flush(tw.w)
+}
+
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
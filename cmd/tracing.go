@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/go-micro/api"
+
+// NewTracerProvider returns a tracer provider exporting spans over OTLP/HTTP to the endpoint,
+// given as host:port or a URL. An empty endpoint uses the exporter defaults.
+func NewTracerProvider(name, endpoint string) (*sdktrace.TracerProvider, error) {
+	var opts []otlptracehttp.Option
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, otlptracehttp.WithEndpoint(u.Host))
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(u.Path) > 0 && u.Path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+	} else if len(endpoint) > 0 {
+		opts = append(opts, otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(name) == 0 {
+		name = "go-micro-api"
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(name))),
+	), nil
+}
+
+// TracingMiddleware starts a server span for each request, recording the resolved
+// service, and propagates the trace context to the backend through the request headers
+func TracingMiddleware(tp trace.TracerProvider) func(http.Handler) http.Handler {
+	tracer := tp.Tracer(tracerName)
+	propagator := otel.GetTextMapPropagator()
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			ctx := propagator.Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+			ctx, span := tracer.Start(ctx, request.Method+" "+request.URL.Path,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", "", request)...),
+			)
+			defer span.End()
+
+			if route, ok := RouteFromContext(ctx); ok {
+				span.SetAttributes(attribute.String("micro.service", route.Service))
+				if route.Endpoint != nil {
+					span.SetAttributes(attribute.String("micro.endpoint", route.Endpoint.Name))
+				}
+			}
+
+			// pass the span on to the backend
+			propagator.Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+			rw := newResponseWriter(writer)
+			handler.ServeHTTP(rw, request.WithContext(ctx))
+
+			span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(rw.status)...)
+			span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(rw.status, trace.SpanKindServer))
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Version prints the build information in a stable "key: value" format
+func (c *cmd) Version(ctx *cli.Context) error {
+	version, commit, date := c.opts.Version, c.opts.Commit, c.opts.BuildDate
+
+	// fall back to the vcs details stamped by the go toolchain
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if len(version) == 0 && info.Main.Version != "(devel)" {
+			version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && len(commit) == 0:
+				commit = s.Value
+			case s.Key == "vcs.time" && len(date) == 0:
+				date = s.Value
+			}
+		}
+	}
+
+	fmt.Fprintf(ctx.App.Writer, "version: %s\n", orUnknown(version))
+	fmt.Fprintf(ctx.App.Writer, "commit: %s\n", orUnknown(commit))
+	fmt.Fprintf(ctx.App.Writer, "build date: %s\n", orUnknown(date))
+	fmt.Fprintf(ctx.App.Writer, "go version: %s\n", runtime.Version())
+	return nil
+}
+
+func orUnknown(s string) string {
+	if len(s) == 0 {
+		return "unknown"
+	}
+	return s
+}
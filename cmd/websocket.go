@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isWebSocket reports whether the request asks to upgrade to a websocket
+func isWebSocket(request *http.Request) bool {
+	return headerContains(request.Header, "Connection", "upgrade") &&
+		headerContains(request.Header, "Upgrade", "websocket")
+}
+
+func headerContains(header http.Header, key, value string) bool {
+	for _, v := range header.Values(key) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bypassWebSocket skips the middleware for websocket upgrades, e.g. middleware
+// buffering the response or bounding its duration which can't apply to a
+// hijacked connection
+func bypassWebSocket(mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		wrapped := mw(handler)
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if isWebSocket(request) {
+				handler.ServeHTTP(writer, request)
+				return
+			}
+			wrapped.ServeHTTP(writer, request)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"go-micro.dev/v4/registry"
+)
+
+func TestWebSocketUpgrade(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, _, err := ws.UpgradeHTTP(r, w)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// echo a single message
+		msg, op, err := wsutil.ReadClientData(conn)
+		if err != nil {
+			return
+		}
+		wsutil.WriteServerMessage(conn, op, msg)
+	}))
+	defer backend.Close()
+
+	reg := registry.NewMemoryRegistry()
+	if err := reg.Register(&registry.Service{
+		Name:  "go.micro.greeter",
+		Nodes: []*registry.Node{{Id: "greeter-1", Address: backend.Listener.Addr().String()}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the hijacked connection passes through every response writer wrapper, those of
+	// compression, timeouts and retries are skipped for upgrades
+	c := newCmd(WithRegistry(reg), WithArgs(
+		"--server_address=127.0.0.1:0",
+		"--handler=web",
+		"--websocket",
+		"--compression",
+		"--request_timeout=5s",
+		"--security_headers",
+		"--response_header=X-Gateway: test",
+		"--normalize_errors",
+		"--access_log",
+		"--retry_count=1",
+	)).(*cmd)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, _, err := ws.Dial(ctx, "ws://"+c.Address()+"/greeter/echo")
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := wsutil.WriteClientText(conn, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := wsutil.ReadServerText(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != "hello" {
+		t.Fatalf("received %q, expected the echoed frame", msg)
+	}
+}
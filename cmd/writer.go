@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+var errHijackUnsupported = errors.New("response writer does not support hijacking")
+
+// responseWriter records the status code and size of a response. It forwards
+// the optional Flusher, Hijacker and Pusher interfaces to the wrapped writer so
+// streams, websockets and server push keep working through the middleware.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	if err == nil && isEventStream(w.Header()) {
+		w.Flush()
+	}
+	return n, err
+}
+
+// Flush sends buffered data to the client, e.g. for streamed events
+func (w *responseWriter) Flush() {
+	flush(w.ResponseWriter)
+}
+
+// Hijack hands the connection over for protocols such as websockets
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := hijack(w.ResponseWriter)
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Push initiates an HTTP/2 server push when the connection supports it
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	return push(w.ResponseWriter, target, opts)
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flush, hijack and push forward the optional interfaces to a wrapped writer, every
+// writer wrapping the response uses them along with an Unwrap method
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errHijackUnsupported
+	}
+	return hj.Hijack()
+}
+
+func push(w http.ResponseWriter, target string, opts *http.PushOptions) error {
+	if p, ok := w.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
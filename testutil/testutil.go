@@ -0,0 +1,51 @@
+// Package testutil runs the gateway in process for end to end tests
+package testutil
+
+import (
+	"strings"
+
+	"github.com/go-micro/api/cmd"
+	"go-micro.dev/v4/registry"
+)
+
+// Start starts a gateway on an ephemeral localhost port discovering services in the
+// registry, an in-memory registry when nil. The args are parsed as the gateway flags,
+// e.g. "--handler=http". It returns the base url of the gateway, https when serving
+// tls, and a func stopping it.
+//
+//	reg := registry.NewMemoryRegistry()
+//	url, stop, err := testutil.Start(reg, []string{"--handler=http"})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer stop()
+func Start(reg registry.Registry, args []string, opts ...cmd.Option) (string, func() error, error) {
+	if reg == nil {
+		reg = registry.NewMemoryRegistry()
+	}
+	if !hasFlag(args, "server_address") {
+		args = append([]string{"--server_address=127.0.0.1:0"}, args...)
+	}
+	opts = append([]cmd.Option{cmd.WithRegistry(reg), cmd.WithArgs(args...)}, opts...)
+
+	gw := cmd.New(opts...)
+	if err := gw.Start(); err != nil {
+		return "", nil, err
+	}
+	scheme := "http://"
+	if gw.Options().TLSConfig != nil {
+		scheme = "https://"
+	}
+	return scheme + gw.Address(), gw.Stop, nil
+}
+
+// hasFlag reports whether the flag is given in the args
+func hasFlag(args []string, name string) bool {
+	for _, arg := range args {
+		arg = strings.TrimLeft(arg, "-")
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+	return false
+}